@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nergy-se/controller/pkg/mbus"
+)
+
+func main() {
+	device := flag.String("device", mbus.DefaultDevice, "serial device of the mbus master or host:port of a M-Bus/TCP gateway")
+	baudRate := flag.Int("baud", mbus.DefaultBaudRate, "baud rate")
+	scan := flag.Bool("scan", false, "list all meters on the bus using secondary address search")
+	primaryID := flag.String("primary", "", "read meter with primary address")
+	secondaryID := flag.String("secondary", "", "read meter with secondary address. example: 90072114361CC702")
+	model := flag.String("model", "", "meter model used when reading values. example: garo-GNM3D-MBUS")
+	jsonOutput := flag.Bool("json", false, "print result as json")
+	flag.Parse()
+
+	bus := mbus.New(*device, *baudRate)
+	defer bus.Close()
+
+	var result interface{}
+	switch {
+	case *scan:
+		devices, err := bus.Scan()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !*jsonOutput {
+			printDevices(devices)
+			return
+		}
+		result = devices
+	case *primaryID != "" || *secondaryID != "":
+		data, err := bus.ReadValues(context.Background(), *model, *primaryID, *secondaryID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result = data
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+}
+
+func printDevices(devices []mbus.Device) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRIMARY\tSECONDARY\tID\tMANUFACTURER\tVERSION\tMEDIUM")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", d.PrimaryID, d.SecondaryID, d.ID, d.Manufacturer, d.Version, d.Medium)
+	}
+	w.Flush()
+}
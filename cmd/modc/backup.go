@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/backup"
+	"github.com/nergy-se/controller/pkg/controller/registry"
+)
+
+func backupOrRestore(conn *connection, backupFile, restoreFile string, controllerType types.HeatControlType, slavePassed bool) error {
+	if restoreFile != "" {
+		b, err := backup.Load(restoreFile)
+		if err != nil {
+			return err
+		}
+		if !slavePassed {
+			conn.setSlaveID(registry.SlaveID(b.Controller))
+		}
+		err = backup.Restore(conn.client, b)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored %d registers from %s taken %s\n", len(b.Registers), restoreFile, b.Time)
+		return nil
+	}
+
+	registers := registry.Registers(controllerType)
+	if registers == nil {
+		return fmt.Errorf("-controller must be one of: %s", knownControllers())
+	}
+	if !slavePassed {
+		conn.setSlaveID(registry.SlaveID(controllerType))
+	}
+	b, err := backup.Create(conn.client, controllerType, registers)
+	if err != nil {
+		return err
+	}
+	err = b.Save(backupFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("saved %d registers to %s\n", len(b.Registers), backupFile)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/modbusclient"
+)
+
+type connection struct {
+	client     modbus.Client
+	setSlaveID func(id byte)
+	close      func() error
+}
+
+// dial creates a modbus TCP connection to address or a RTU connection if rtuDevice is set.
+func dial(address, rtuDevice string, baudRate, dataBits, stopBits int, parity string, slaveID byte) (*connection, error) {
+	if rtuDevice != "" {
+		handler := modbus.NewRTUClientHandler(rtuDevice)
+		handler.BaudRate = baudRate
+		handler.DataBits = dataBits
+		handler.StopBits = stopBits
+		handler.Parity = parity
+		handler.SlaveId = slaveID
+		handler.Timeout = 2 * time.Second
+		if err := handler.Connect(); err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", rtuDevice, err)
+		}
+		return &connection{
+			client:     modbus.NewClient(handler),
+			setSlaveID: func(id byte) { handler.SlaveId = id },
+			close:      handler.Close,
+		}, nil
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("-addr or -rtu is required")
+	}
+	handler := modbus.NewTCPClientHandler(address)
+	handler.SlaveId = slaveID
+	return &connection{
+		client:     modbus.NewClient(handler),
+		setSlaveID: func(id byte) { handler.SlaveId = id },
+		close:      handler.Close,
+	}, nil
+}
+
+func parseValues(s string) ([]float64, error) {
+	var values []float64
+	for _, v := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value %s: %w", v, err)
+		}
+		values = append(values, f)
+	}
+	return values, nil
+}
+
+// readTyped reads count values of dataType starting at address and prints them.
+func readTyped(read func(address, quantity uint16) ([]byte, error), address uint16, count uint16, dataType modbusclient.DataType, order modbusclient.WordOrder) error {
+	size := dataType.Registers()
+	b, err := read(address, size*count)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("raw response: %# x (length: %d)\n", b, len(b))
+	for i := uint16(0); i < count; i++ {
+		start := int(i * size * 2)
+		if start >= len(b) {
+			break
+		}
+		v, err := modbusclient.DecodeType(b[start:], dataType, order)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d: %s\n", address+i*size, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return nil
+}
+
+// writeRegisters writes values as dataType starting at address using write multiple registers.
+func writeRegisters(client modbus.Client, address uint16, values []float64, dataType modbusclient.DataType, order modbusclient.WordOrder) ([]byte, error) {
+	var data []byte
+	for _, v := range values {
+		b, err := modbusclient.EncodeType(v, dataType, order)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b...)
+	}
+	return client.WriteMultipleRegisters(address, uint16(len(data)/2), data)
+}
+
+// writeCoils writes values as coils starting at address using write multiple coils. Any non zero value is true.
+func writeCoils(client modbus.Client, address uint16, values []float64) ([]byte, error) {
+	data := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v != 0 {
+			data[i/8] |= 1 << (i % 8)
+		}
+	}
+	return client.WriteMultipleCoils(address, uint16(len(values)), data)
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/nergy-se/controller/pkg/controller/registry"
 	"github.com/nergy-se/controller/pkg/modbusclient"
 )
 
@@ -14,6 +22,11 @@ var readCount = flag.Uint("read-count", 1, "how many addreses to read")
 
 func main() {
 	address := flag.String("addr", "", "tcp modbus address")
+	rtuDevice := flag.String("rtu", "", "serial device for modbus RTU. example: /dev/ttyUSB0")
+	baudRate := flag.Int("baud", 9600, "RTU baud rate")
+	dataBits := flag.Int("databits", 8, "RTU data bits")
+	stopBits := flag.Int("stopbits", 1, "RTU stop bits")
+	parity := flag.String("parity", "E", "RTU parity N, E or O")
 
 	inputreg := flag.Int("inputreg", 0, "input reg")
 	discreteInput := flag.Int("discreteinputreg", 0, "descrete input reg")
@@ -22,36 +35,128 @@ func main() {
 
 	slaveID := flag.Int("slave", 0, "modbus slave id")
 	value := flag.Int("value", 0, "value to write. will write any value")
+	values := flag.String("values", "", "comma separated values to write with write multiple registers/coils. registers are encoded using -type")
+
+	dataType := flag.String("type", "", "read/write values as uint16, int16, uint32, int32 or float32 instead of using -decimals")
+	wordOrder := flag.String("word-order", "big", "word order for 32 bit types. big = high word first, little = low word first")
+
+	reg := flag.String("reg", "", "comma separated named registers to read. example: thermiagenesis.outdoor,thermiagenesis.indoor")
+	dump := flag.String("dump", "", "read all known registers for controller. example: thermiagenesis")
+
+	backupFile := flag.String("backup", "", "write backup of all writable registers for -controller to file")
+	restoreFile := flag.String("restore", "", "restore registers from backup file")
+	controllerType := flag.String("controller", "", "controller type used by -backup. example: thermiagenesis")
+
+	watchFlag := flag.Bool("watch", false, "poll registers from -reg, -dump or -inputreg/-holdingreg/-coil/-discreteinputreg with -read-count and print changes. changed values are highlighted when stdout is a terminal")
+	interval := flag.Duration("interval", time.Second, "poll interval in watch mode")
 	flag.Parse()
 
-	handler := modbus.NewTCPClientHandler(*address)
-	handler.SlaveId = byte(*slaveID)
-	mcli := modbus.NewClient(handler)
+	order := modbusclient.WordOrder(*wordOrder)
+	if order != modbusclient.WordOrderBig && order != modbusclient.WordOrderLittle {
+		log.Fatalf("invalid -word-order %q. use big or little", *wordOrder)
+	}
+
+	conn, err := dial(*address, *rtuDevice, *baudRate, *dataBits, *stopBits, *parity, byte(*slaveID))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.close()
+	mcli := conn.client
 	client := &Client{client: mcli}
 
+	if isFlagPassed("backup") || isFlagPassed("restore") {
+		err = backupOrRestore(conn, *backupFile, *restoreFile, types.HeatControlType(*controllerType), isFlagPassed("slave"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var groups []watchGroup
+	if isFlagPassed("reg") || isFlagPassed("dump") {
+		registers, controllerName, err := namedRegisters(*reg, *dump)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !isFlagPassed("slave") {
+			conn.setSlaveID(registry.SlaveID(types.HeatControlType(controllerName)))
+		}
+		if !*watchFlag {
+			printRegisters(mcli, registers)
+			return
+		}
+		groups = watchNamed(mcli, registers)
+	}
+
+	if *watchFlag {
+		if isFlagPassed("inputreg") {
+			groups = append(groups, watchRange(mcli, controller.RegisterTypeInput, uint16(*inputreg), uint16(*readCount)))
+		}
+		if isFlagPassed("holdingreg") {
+			groups = append(groups, watchRange(mcli, controller.RegisterTypeHolding, uint16(*holdingreg), uint16(*readCount)))
+		}
+		if isFlagPassed("coil") {
+			groups = append(groups, watchRange(mcli, controller.RegisterTypeCoil, uint16(*coil), uint16(*readCount)))
+		}
+		if isFlagPassed("discreteinputreg") {
+			groups = append(groups, watchRange(mcli, controller.RegisterTypeDiscreteInput, uint16(*discreteInput), uint16(*readCount)))
+		}
+		if len(groups) == 0 {
+			log.Fatal("nothing to watch. use -reg, -dump or a register flag")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		watch(ctx, groups, *interval, isTerminal())
+		return
+	}
+
+	typ := modbusclient.DataType(*dataType)
+	var writeValues []float64
+	if isFlagPassed("values") {
+		writeValues, err = parseValues(*values)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if typ == "" {
+			typ = modbusclient.DataTypeInt16
+		}
+	}
+
 	var f interface{}
-	var err error
 	if isFlagPassed("inputreg") {
-		f, err = scale100itof(client.readInputRegister(uint16(*inputreg)))
+		if typ != "" {
+			err = readTyped(mcli.ReadInputRegisters, uint16(*inputreg), uint16(*readCount), typ, order)
+		} else {
+			f, err = scale100itof(client.readInputRegister(uint16(*inputreg)))
+		}
 	}
 	if isFlagPassed("holdingreg") {
-		if isFlagPassed("value") {
-			f, err = client.client.WriteSingleRegister(uint16(*holdingreg), uint16(*value))
-		} else {
+		switch {
+		case writeValues != nil:
+			f, err = writeRegisters(mcli, uint16(*holdingreg), writeValues, typ, order)
+		case isFlagPassed("value"):
+			f, err = mcli.WriteSingleRegister(uint16(*holdingreg), uint16(*value))
+		case typ != "":
+			err = readTyped(mcli.ReadHoldingRegisters, uint16(*holdingreg), uint16(*readCount), typ, order)
+		default:
 			f, err = scale100itof(client.readHoldingRegister(uint16(*holdingreg)))
 		}
 	}
 
 	if isFlagPassed("coil") {
-		if isFlagPassed("value") {
-			f, err = client.client.WriteSingleCoil(uint16(*coil), uint16(*value))
+		switch {
+		case writeValues != nil:
+			f, err = writeCoils(mcli, uint16(*coil), writeValues)
+		case isFlagPassed("value"):
+			f, err = mcli.WriteSingleCoil(uint16(*coil), uint16(*value))
 			// value måste vara 0xff00 dvs INT 65280
-		} else {
-			f, err = client.client.ReadCoils(uint16(*coil), 1)
+		default:
+			f, err = mcli.ReadCoils(uint16(*coil), uint16(*readCount))
 		}
 	}
 	if isFlagPassed("discreteinputreg") {
-		f, err = client.client.ReadDiscreteInputs(uint16(*discreteInput), 1)
+		f, err = mcli.ReadDiscreteInputs(uint16(*discreteInput), uint16(*readCount))
 	}
 
 	if err != nil {
@@ -60,8 +165,9 @@ func main() {
 	if v, ok := f.([]byte); ok {
 		fmt.Printf("raw response: %# x (length: %d)\n", v, len(v))
 	}
-	log.Println("value is: ", f)
-	handler.Close()
+	if f != nil {
+		log.Println("value is: ", f)
+	}
 }
 func isFlagPassed(name string) bool {
 	found := false
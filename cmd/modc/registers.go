@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/nergy-se/controller/pkg/controller/registry"
+)
+
+type namedRegister struct {
+	controller.Register
+	controller string
+}
+
+func (r namedRegister) FullName() string {
+	return r.controller + "." + r.Name
+}
+
+// namedRegisters resolves registers from names like thermiagenesis.outdoor or all registers for a controller name.
+func namedRegisters(names, dump string) ([]namedRegister, string, error) {
+	if dump != "" {
+		regs := registry.Registers(types.HeatControlType(dump))
+		if regs == nil {
+			return nil, "", fmt.Errorf("unknown controller %s. known controllers: %s", dump, knownControllers())
+		}
+		result := make([]namedRegister, len(regs))
+		for i, r := range regs {
+			result[i] = namedRegister{Register: r, controller: dump}
+		}
+		return result, dump, nil
+	}
+
+	var result []namedRegister
+	controllerName := ""
+	for _, name := range strings.Split(names, ",") {
+		r, err := findRegister(strings.TrimSpace(name))
+		if err != nil {
+			return nil, "", err
+		}
+		if controllerName != "" && controllerName != r.controller {
+			return nil, "", fmt.Errorf("all registers must belong to the same controller got %s and %s", controllerName, r.controller)
+		}
+		controllerName = r.controller
+		result = append(result, r)
+	}
+	return result, controllerName, nil
+}
+
+func findRegister(name string) (namedRegister, error) {
+	controllerName, regName, ok := strings.Cut(name, ".")
+	if !ok {
+		return namedRegister{}, fmt.Errorf("register name must be in format controller.name got: %s", name)
+	}
+	regs := registry.Registers(types.HeatControlType(controllerName))
+	if regs == nil {
+		return namedRegister{}, fmt.Errorf("unknown controller %s. known controllers: %s", controllerName, knownControllers())
+	}
+	r, ok := controller.FindRegister(regs, regName)
+	if !ok {
+		return namedRegister{}, fmt.Errorf("unknown register %s for controller %s", regName, controllerName)
+	}
+	return namedRegister{Register: r, controller: controllerName}, nil
+}
+
+func knownControllers() string {
+	var names []string
+	for _, t := range registry.Types() {
+		names = append(names, string(t))
+	}
+	return strings.Join(names, ", ")
+}
+
+func printRegisters(client modbus.Client, registers []namedRegister) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tADDRESS\tVALUE\tDESCRIPTION")
+	for _, r := range registers {
+		value, err := r.Read(client)
+		valueStr := r.String(value)
+		if err != nil {
+			valueStr = fmt.Sprintf("error: %s", err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.FullName(), r.Type, r.Address, valueStr, r.Description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/nergy-se/controller/pkg/modbusclient"
+)
+
+type watchValue struct {
+	name  string
+	value string
+}
+
+// watchGroup is one modbus read which results in one or more watched values.
+type watchGroup struct {
+	read func() ([]watchValue, error)
+}
+
+// watchNamed watches named registers. Each register is read separately since they are spread out.
+func watchNamed(client modbus.Client, registers []namedRegister) []watchGroup {
+	groups := make([]watchGroup, len(registers))
+	for i, r := range registers {
+		r := r
+		groups[i] = watchGroup{read: func() ([]watchValue, error) {
+			v, err := r.Read(client)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", r.FullName(), err)
+			}
+			return []watchValue{{name: r.FullName(), value: r.String(v)}}, nil
+		}}
+	}
+	return groups
+}
+
+// watchRange watches count addresses starting at address with one read per poll.
+func watchRange(client modbus.Client, regType controller.RegisterType, address, count uint16) watchGroup {
+	return watchGroup{read: func() ([]watchValue, error) {
+		var b []byte
+		var err error
+		switch regType {
+		case controller.RegisterTypeInput:
+			b, err = client.ReadInputRegisters(address, count)
+		case controller.RegisterTypeHolding:
+			b, err = client.ReadHoldingRegisters(address, count)
+		case controller.RegisterTypeCoil:
+			b, err = client.ReadCoils(address, count)
+		case controller.RegisterTypeDiscreteInput:
+			b, err = client.ReadDiscreteInputs(address, count)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", regType, address, err)
+		}
+
+		var values []watchValue
+		for i := uint16(0); i < count; i++ {
+			name := fmt.Sprintf("%s %d", regType, address+i)
+			if regType == controller.RegisterTypeCoil || regType == controller.RegisterTypeDiscreteInput {
+				if int(i/8) < len(b) {
+					values = append(values, watchValue{name: name, value: fmt.Sprintf("%t", b[i/8]&(1<<(i%8)) != 0)})
+				}
+				continue
+			}
+			if int(i*2+2) <= len(b) {
+				raw := b[i*2 : i*2+2]
+				values = append(values, watchValue{name: name, value: fmt.Sprintf("%d (%# x)", modbusclient.Decode(raw), raw)})
+			}
+		}
+		return values, nil
+	}}
+}
+
+// isTerminal reports if stdout is a terminal and NO_COLOR is not set.
+func isTerminal() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// highlight makes s bold yellow with ANSI escape codes if color is set.
+func highlight(s string, color bool) string {
+	if !color {
+		return s
+	}
+	return "\x1b[1;33m" + s + "\x1b[0m"
+}
+
+// watch polls all groups each interval and prints values that changed since last poll.
+// Changed values are highlighted if color is set.
+func watch(ctx context.Context, groups []watchGroup, interval time.Duration, color bool) {
+	last := make(map[string]string)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	first := true
+	for {
+		now := time.Now().Format("15:04:05.000")
+		for _, g := range groups {
+			values, err := g.read()
+			if err != nil {
+				fmt.Printf("%s error: %s\n", now, err)
+				continue
+			}
+			for _, v := range values {
+				old, seen := last[v.name]
+				switch {
+				case first || !seen:
+					fmt.Printf("%s %s: %s\n", now, v.name, v.value)
+				case old != v.value:
+					fmt.Printf("%s %s: %s -> %s\n", now, v.name, old, highlight(v.value, color))
+				}
+				last[v.name] = v.value
+			}
+		}
+		if first {
+			fmt.Printf("%s watching for changes every %s\n", now, interval)
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
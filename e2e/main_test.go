@@ -1,19 +1,24 @@
 package e2e
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/fortnoxab/gohtmock"
 	"github.com/nergy-se/controller/pkg/api/v1/config"
 	"github.com/nergy-se/controller/pkg/app"
+	"github.com/nergy-se/controller/pkg/override"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/tbrandon/mbserver"
@@ -597,3 +602,383 @@ func TestThermiaAllowedMaxIndoorTemp(t *testing.T) {
 	mock.AssertCallCount(t, "POST", "/api/controller/metrics-v1", 1)
 	mock.AssertMocksCalled(t)
 }
+
+func TestThermiaOverride(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	mock := gohtmock.New()
+	config := &config.CliConfig{
+		Server:     mock.URL(),
+		SerialFile: "/dev/null",
+		APIToken:   "mysecrettoken",
+	}
+	app := app.New(config)
+
+	done := make(chan bool)
+	mock.Mock("/api/controller/config-v1", `
+{
+  "controllerId": "88e7f9b7-7a6d-41e1-9861-081799844311",
+  "heatControlType": "thermiagenesis",
+  "address": "127.0.0.1:1502",
+  "hotWaterBoostStartTemperature": 52,
+  "hotWaterBoostStopTemperature": 58,
+  "hotWaterNormalStartTemperature": 45,
+  "hotWaterNormalStopTemperature": 57
+}`)
+
+	mock.Mock("/api/controller/schedule-v1", fmt.Sprintf(`
+{
+  "%[1]s": {
+    "time": "%[1]s",
+    "price": 0.417,
+    "hotwater": false,
+    "hotwaterForce": false,
+    "heating": false
+  }
+}`, time.Now().Format(time.RFC3339)))
+	mock.Mock("/api/controller/config-v1", "", func(r *http.Request) int {
+		return 200
+	}).SetMethod("POST")
+	mock.Mock("/api/controller/metrics-v1", "", func(r *http.Request) int {
+		defer close(done)
+		return 200
+	}).SetMethod("POST")
+	overrides := make(chan string, 10)
+	record := func(r *http.Request) int {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		overrides <- string(b)
+		return 200
+	}
+	var records []func(*http.Request) int
+	for i := 0; i < cap(overrides); i++ {
+		records = append(records, record)
+	}
+	mock.Mock("/api/controller/overrides-v1", "", records...).SetMethod("POST")
+	reported := func(ok func(body string) bool) func() bool {
+		return func() bool {
+			select {
+			case body := <-overrides:
+				return ok(body)
+			default:
+				return false
+			}
+		}
+	}
+
+	serv := mbserver.NewServer()
+	serv.InputRegisters[121] = toUint(21.0 * 10) // Indoor temp
+	serv.InputRegisters[17] = toUint(50.0 * 100) // hotwater temp
+	err := serv.ListenTCP("127.0.0.1:1502")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	err = app.Start(ctx)
+	assert.NoError(t, err)
+
+	<-done
+	assert.Equal(t, uint8(0), serv.Coils[8]) // allow hotwater
+	assert.Equal(t, uint8(0), serv.Coils[9]) // allow heating
+
+	assert.NoError(t, app.SetOverride(override.Heating, time.Hour))
+	assert.NoError(t, app.SetOverride(override.Boost, time.Hour))
+	WaitFor(t, time.Second, "overrides reported", reported(func(body string) bool {
+		return strings.Contains(body, `"kind":"boost"`) && strings.Contains(body, `"kind":"heating"`)
+	}))
+	assert.Equal(t, uint8(1), serv.Coils[8])
+	assert.Equal(t, uint8(1), serv.Coils[9])
+	assert.Equal(t, uint16(5200), serv.HoldingRegisters[22])
+	assert.Equal(t, uint16(5800), serv.HoldingRegisters[23])
+
+	assert.NoError(t, app.SetOverride(override.Heating, 0))
+	assert.NoError(t, app.SetOverride(override.Boost, 50*time.Millisecond)) // expires by itself
+	WaitFor(t, time.Second, "overrides expired", reported(func(body string) bool {
+		return body == "[]"
+	}))
+	assert.Equal(t, uint8(0), serv.Coils[8])
+	assert.Equal(t, uint8(0), serv.Coils[9])
+	assert.Equal(t, uint16(4500), serv.HoldingRegisters[22])
+	assert.Equal(t, uint16(5700), serv.HoldingRegisters[23])
+	mock.AssertMocksCalled(t)
+}
+
+func TestThermiaBackupAndRestore(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	mock := gohtmock.New()
+	config := &config.CliConfig{
+		Server:     mock.URL(),
+		SerialFile: "/dev/null",
+		APIToken:   "mysecrettoken",
+		BackupFile: filepath.Join(t.TempDir(), "backup.json"),
+	}
+	app := app.New(config)
+
+	mock.Mock("/api/controller/config-v1", `
+{
+  "controllerId": "88e7f9b7-7a6d-41e1-9861-081799844311",
+  "heatControlType": "thermiagenesis",
+  "address": "127.0.0.1:1502",
+  "hotWaterBoostStartTemperature": 52,
+  "hotWaterBoostStopTemperature": 58,
+  "hotWaterNormalStartTemperature": 45,
+  "hotWaterNormalStopTemperature": 57,
+  "districtHeatingPrice": 0
+}`)
+
+	mock.Mock("/api/controller/schedule-v1", fmt.Sprintf(`
+{
+  "%[1]s": {
+    "time": "%[1]s",
+    "price": 0.417,
+    "hotwater": true,
+    "hotwaterForce": false,
+    "heating": true
+  }
+}`, time.Now().Format(time.RFC3339)))
+	mock.Mock("/api/controller/config-v1", "", func(r *http.Request) int {
+		return 200
+	}).SetMethod("POST")
+	mock.Mock("/api/controller/backup-v1", "", func(r *http.Request) int {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), `"controller":"thermiagenesis"`)
+		assert.Contains(t, string(b), `{"name":"hotWaterStartTemperature","type":"holdingreg","address":22,"data":[4800],"value":48}`)
+		return 200
+	}).SetMethod("POST")
+	mock.Mock("/api/controller/metrics-v1", "", func(r *http.Request) int {
+		return 200
+	}).SetMethod("POST").SetHeader("x-fetch", "RestoreBackup")
+	mock.Mock("/api/controller/backup-v1", `
+{
+  "version": 1,
+  "controller": "thermiagenesis",
+  "registers": [
+    {"name": "hotWaterStartTemperature", "type": "holdingreg", "address": 22, "data": [4800]},
+    {"name": "allowHeating", "type": "coil", "address": 9, "data": [0]}
+  ]
+}`).Filter(func(r *http.Request) bool {
+		return r.Header.Get("x-fetch") == "RestoreBackup"
+	})
+
+	serv := mbserver.NewServer()
+	serv.HoldingRegisters[22] = 4800
+	err := serv.ListenTCP("127.0.0.1:1502")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	err = app.Start(ctx)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, config.BackupFile) // contains 4800 from before reconcile wrote 4500
+
+	// the backup is saved as restored after the registers are written. reading the registers
+	// directly while the app writes them would race.
+	WaitFor(t, time.Second, "wait for restore", func() bool {
+		b, err := os.ReadFile(config.BackupFile)
+		return err == nil && strings.Contains(string(b), `"restored"`)
+	})
+	assert.Equal(t, uint16(4800), serv.HoldingRegisters[22])
+	assert.Equal(t, uint8(0), serv.Coils[9])
+
+	app.DoReconcile() // control is suspended so the restored values are kept
+	assert.Equal(t, uint16(4800), serv.HoldingRegisters[22])
+	assert.Equal(t, uint8(0), serv.Coils[9])
+
+	mock.AssertCallCount(t, "POST", "/api/controller/backup-v1", 1)
+	mock.AssertMocksCalled(t)
+}
+
+func TestThermiaBackupUploadRetried(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	mock := gohtmock.New()
+	config := &config.CliConfig{
+		Server:     mock.URL(),
+		SerialFile: "/dev/null",
+		APIToken:   "mysecrettoken",
+		BackupFile: filepath.Join(t.TempDir(), "backup.json"),
+	}
+
+	mock.Mock("/api/controller/config-v1", `
+{
+  "controllerId": "88e7f9b7-7a6d-41e1-9861-081799844311",
+  "heatControlType": "thermiagenesis",
+  "address": "127.0.0.1:1502"
+}`)
+	mock.Mock("/api/controller/schedule-v1", `{}`)
+	mock.Mock("/api/controller/config-v1", "").SetMethod("POST")
+
+	uploaded := make(chan bool, 1)
+	ok := func(r *http.Request) int {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), `"controller":"thermiagenesis"`)
+		uploaded <- true
+		return 200
+	}
+	// the first upload fails and is sent again from the retry queue.
+	mock.Mock("/api/controller/backup-v1", "", func(r *http.Request) int { return 500 }, ok).SetMethod("POST")
+
+	serv := mbserver.NewServer()
+	serv.HoldingRegisters[22] = 4800
+	err := serv.ListenTCP("127.0.0.1:1502")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	a := app.New(config)
+	err = a.Start(ctx)
+	assert.NoError(t, err)
+	<-uploaded
+	cancel()
+	a.Wait()
+
+	b, err := os.ReadFile(config.BackupFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"uploaded": true`)
+	assert.NotContains(t, string(b), `"restored"`)
+
+	// not uploaded again after restart
+	ctx, cancel = context.WithCancel(context.TODO())
+	defer cancel()
+	a = app.New(config)
+	err = a.Start(ctx)
+	assert.NoError(t, err)
+
+	mock.AssertCallCount(t, "POST", "/api/controller/backup-v1", 2)
+	mock.AssertMocksCalled(t)
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	mock := gohtmock.New()
+	config := &config.CliConfig{
+		Server:     mock.URL(),
+		SerialFile: "/dev/null",
+		APIToken:   "mysecrettoken",
+		QueueFile:  filepath.Join(t.TempDir(), "nergyqueue"),
+	}
+
+	mock.Mock("/api/controller/config-v1", `
+{
+  "controllerId": "88e7f9b7-7a6d-41e1-9861-081799844311",
+  "heatControlType": "thermiagenesis",
+  "address": "127.0.0.1:1502",
+  "heatCurveAdjust": 0,
+  "heatCurve": [19, 26, 31, 35, 38, 45, 52],
+  "heatingSeasonStopTemperature": 13
+}`)
+	mock.Mock("/api/controller/schedule-v1", `{}`)
+	mock.Mock("/api/controller/metrics-v1", "").SetMethod("POST")
+
+	failed := make(chan bool)
+	resent := make(chan bool, 2)
+	fail := func(r *http.Request) int {
+		select {
+		case failed <- true:
+		default:
+		}
+		return 500
+	}
+	ok := func(r *http.Request) int {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), `"heatCurve":[`)
+		resent <- true
+		return 200
+	}
+	// first POST and its retry fail. after restart the queued request and the new one are sent.
+	mock.Mock("/api/controller/config-v1", "", fail, fail, ok, ok).SetMethod("POST")
+
+	serv := mbserver.NewServer()
+	err := serv.ListenTCP("127.0.0.1:1502")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	a := app.New(config)
+	err = a.Start(ctx)
+	assert.NoError(t, err)
+	<-failed // the retry
+	cancel()
+	a.Wait()
+
+	ctx, cancel = context.WithCancel(context.TODO())
+	defer cancel()
+	a = app.New(config)
+	err = a.Start(ctx)
+	assert.NoError(t, err)
+	<-resent
+	<-resent
+
+	mock.AssertCallCount(t, "POST", "/api/controller/config-v1", 4)
+	mock.AssertMocksCalled(t)
+}
+
+func TestBatchUpload(t *testing.T) {
+	logrus.SetLevel(logrus.DebugLevel)
+	mock := gohtmock.New()
+	config := &config.CliConfig{
+		Server:     mock.URL(),
+		SerialFile: "/dev/null",
+		APIToken:   "mysecrettoken",
+	}
+	app := app.New(config)
+
+	mock.Mock("/api/controller/config-v1", `
+{
+  "controllerId": "88e7f9b7-7a6d-41e1-9861-081799844311",
+  "heatControlType": "thermiagenesis",
+  "address": "127.0.0.1:1502",
+  "heatCurveAdjust": 0,
+  "heatCurve": [19, 26, 31, 35, 38, 45, 52],
+  "heatingSeasonStopTemperature": 13
+}`)
+	mock.Mock("/api/controller/schedule-v1", `{}`)
+	mock.Mock("/api/controller/config-v1", "").SetMethod("POST")
+
+	type item struct {
+		URL  string          `json:"url"`
+		Body json.RawMessage `json:"body"`
+	}
+	batches := make(chan []item, 2)
+	handler := func(code int) func(r *http.Request) int {
+		return func(r *http.Request) int {
+			assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+			gz, err := gzip.NewReader(r.Body)
+			assert.NoError(t, err)
+			var batch struct {
+				Items []item `json:"items"`
+			}
+			assert.NoError(t, json.NewDecoder(gz).Decode(&batch))
+			batches <- batch.Items
+			return code
+		}
+	}
+	// the first upload fails and is retried from the queue.
+	mock.Mock("/api/controller/batch-v1", "", handler(500), handler(200)).SetMethod("POST")
+
+	serv := mbserver.NewServer()
+	serv.InputRegisters[121] = toUint(21.0 * 10) // Indoor temp
+	err := serv.ListenTCP("127.0.0.1:1502")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	err = app.Start(ctx)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		items := <-batches
+		if assert.Len(t, items, 1) {
+			assert.Equal(t, "api/controller/metrics-v1", items[0].URL)
+			assert.Contains(t, string(items[0].Body), `"indoor":21`)
+		}
+	}
+
+	mock.AssertCallCount(t, "POST", "/api/controller/batch-v1", 2)
+	mock.AssertMocksCalled(t)
+}
@@ -3,9 +3,11 @@ module github.com/nergy-se/controller
 go 1.21
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/fortnoxab/gohtmock v0.0.0-20250130102025-46560d1dbf38
 	github.com/goburrow/modbus v0.1.0
 	github.com/jonaz/gombus v0.0.0-20240104212355-b2bf5440f211
+	github.com/jonaz/serial v0.0.0-20240104211900-cac2ee15ec1f
 	github.com/koding/multiconfig v0.0.0-20171124222453-69c27309b2d7
 	github.com/mochi-mqtt/server/v2 v2.6.6
 	github.com/sirupsen/logrus v1.9.0
@@ -20,9 +22,10 @@ require (
 	github.com/fatih/structs v1.1.0 // indirect
 	github.com/goburrow/serial v0.1.0 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
-	github.com/jonaz/serial v0.0.0-20240104211900-cac2ee15ec1f // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sync v0.2.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 type CliConfig struct {
@@ -17,6 +18,40 @@ type CliConfig struct {
 	ControllerType string
 	Address        string
 
+	BackupFile string `default:"/etc/nergybackup.json"`
+
+	QueueFile         string        `default:"/etc/nergyqueue"` // requests which failed to send are kept here until sent. empty keeps them only in memory
+	QueueMaxSize      int           `default:"52428800"`        // bytes
+	QueueSyncInterval time.Duration `default:"10s"`             // how often queued requests are flushed to disk
+
+	MbusDevice   string // default M-Bus device used when meter has no address. Empty means mbus.DefaultDevice
+	MbusBaudRate int    // empty means mbus.DefaultBaudRate
+
+	WmbusDevice   string `default:"/dev/ttyUSB0"` // default wM-Bus receiver used when meter has no address
+	WmbusBaudRate int    `default:"9600"`
+
+	P1Device   string // P1/HAN port used when meter has no address. Empty means p1 meters must set address
+	P1BaudRate int    `default:"115200"`
+
+	MqttAddress          string `default:":1883"` // empty disables plain TCP
+	MqttTLSAddress       string // example :8883. empty disables TLS
+	MqttTLSCert          string `default:"/etc/nergymqtt.crt"` // self signed certificate is generated if missing
+	MqttTLSKey           string `default:"/etc/nergymqtt.key"`
+	MqttWebsocketAddress string // example :8080. empty disables websocket
+
+	MqttPrefix   string `default:"nergy"` // state, schedule and alarms are published under this prefix
+	MqttUsername string // client allowed to read MqttPrefix/#. starts the broker even without mqtt meters
+	MqttPassword string
+
+	MqttDiscoveryPrefix string `default:"homeassistant"` // Home Assistant discovery. empty disables
+
+	// MqttBroker connects to an external broker instead of starting the embedded one. Example tcp://mosquitto:1883 or ssl://broker:8883
+	MqttBroker         string
+	MqttBrokerClientID string // empty means nergy-<serial>
+	MqttBrokerUsername string
+	MqttBrokerPassword string
+	MqttBrokerCA       string // CA certificates for ssl://. empty means system roots
+
 	Serial string
 
 	LogLevel string `default:"info"`
@@ -34,7 +34,39 @@ type Meter struct {
 	Model         string `json:"model"`
 	Position      string `json:"position"` // where is the meter connected heatpump
 	PrimaryID     string `json:"primaryId"`
-	Address       string `json:"address"`
+	SecondaryID   string `json:"secondaryId,omitempty"` // for mbus. 16 character secondary address. Used instead of PrimaryID if set
+	Address       string `json:"address"`               // for mbus the serial device or host:port of a M-Bus/TCP gateway. Empty means CliConfig.MbusDevice. for wmbus the receiver. for p1 the serial device, empty means CliConfig.P1Device
+	BaudRate      int    `json:"baudRate,omitempty"`    // for mbus, wmbus and p1. Empty means CliConfig.MbusBaudRate, CliConfig.WmbusBaudRate or CliConfig.P1BaudRate
+	Key           string `json:"key,omitempty"`         // for wmbus. hex encoded AES-128 key
+	Username      string `json:"username,omitempty"`    // for mqtt
+	Password      string `json:"password,omitempty"`    // for mqtt
+	TopicPrefix   string `json:"topicPrefix,omitempty"` // for mqtt. the meter can only use topics under this prefix. Empty means model except for generic and room-temperature. must be unique
+
+	Topic  string         `json:"topic,omitempty"`  // for mqtt model generic and room-temperature. topic with the payload
+	Fields []FieldMapping `json:"fields,omitempty"` // for mqtt model generic. for room-temperature the first is the temperature
+	MaxAge int            `json:"maxAge,omitempty"` // for mqtt, wmbus and p1. seconds before received data is ignored. 0 means 300 or 5400 for room-temperature
+
+	PollInterval int `json:"pollInterval,omitempty"` // seconds. 0 means every metrics tick
+	Retries      int `json:"retries,omitempty"`
+	Timeout      int `json:"timeout,omitempty"`     // seconds per attempt. 0 means 10
+	SilentAlarm  int `json:"silentAlarm,omitempty"` // seconds without a successful read before alarm. 0 means 900
+}
+
+// FieldMapping maps a value in a mqtt payload to a meter.Data field.
+type FieldMapping struct {
+	Topic string  `json:"topic,omitempty"` // overrides Meter.Topic for devices publishing one value per topic like ESPHome
+	Path  string  `json:"path"`            // dot separated json path. example ENERGY.Power or emeters.0.power. Empty means the payload is the value
+	Field string  `json:"field"`           // json name in meter.Data. example w, wh or l1_a
+	Scale float64 `json:"scale,omitempty"` // the value is multiplied with scale. 0 means 1
+}
+
+// Identifier uniquely identifies the meter among all configured meters.
+func (m Meter) Identifier() string {
+	id := m.PrimaryID
+	if m.SecondaryID != "" {
+		id = m.SecondaryID
+	}
+	return m.InterfaceType + ":" + m.Address + ":" + id
 }
 
 func CloudConfigNeedsControllerSetup(old *CloudConfig, new *CloudConfig) bool {
@@ -1,19 +1,51 @@
 package meter
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
+type cached struct {
+	data     *Data
+	received time.Time
+}
+
+// Cache keeps the latest data received from each meter keyed by meter id.
 type Cache struct {
-	data *Data
+	data map[string]cached
 	sync.RWMutex
 }
 
-func (c *Cache) Get() *Data {
+// Get returns nil if nothing has been received from id.
+func (c *Cache) Get(id string) *Data {
+	c.RLock()
+	defer c.RUnlock()
+	return c.data[id].data
+}
+
+// LastReceived is zero if nothing has been received from id.
+func (c *Cache) LastReceived(id string) time.Time {
 	c.RLock()
 	defer c.RUnlock()
-	return c.data
+	return c.data[id].received
 }
-func (c *Cache) Set(d *Data) {
+
+func (c *Cache) Set(id string, d *Data) {
 	c.Lock()
-	c.data = d
+	if c.data == nil {
+		c.data = make(map[string]cached)
+	}
+	c.data[id] = cached{data: d, received: time.Now()}
 	c.Unlock()
 }
+
+// Prune removes meters for which keep returns false.
+func (c *Cache) Prune(keep func(id string) bool) {
+	c.Lock()
+	defer c.Unlock()
+	for id := range c.data {
+		if !keep(id) {
+			delete(c.data, id)
+		}
+	}
+}
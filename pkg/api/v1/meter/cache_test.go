@@ -0,0 +1,25 @@
+package meter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	c := &Cache{}
+	assert.Nil(t, c.Get("mqtt::1"))
+	assert.True(t, c.LastReceived("mqtt::1").IsZero())
+
+	before := time.Now()
+	c.Set("mqtt::1", &Data{Id: "1", Current_W: 100})
+	c.Set("mqtt::2", &Data{Id: "2", Current_W: 200})
+	assert.Equal(t, 100.0, c.Get("mqtt::1").Current_W)
+	assert.Equal(t, 200.0, c.Get("mqtt::2").Current_W)
+	assert.False(t, c.LastReceived("mqtt::1").Before(before))
+
+	c.Prune(func(id string) bool { return id == "mqtt::2" })
+	assert.Nil(t, c.Get("mqtt::1"))
+	assert.NotNil(t, c.Get("mqtt::2"))
+}
@@ -0,0 +1,15 @@
+package meter
+
+import "time"
+
+// Health is the polling status of one configured meter.
+type Health struct {
+	Id                  string    `json:"id"`
+	InterfaceType       string    `json:"interfaceType"`
+	Model               string    `json:"model"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastErrorTime       time.Time `json:"lastErrorTime"`
+	LastReceived        time.Time `json:"lastReceived"` // for meters pushing data like mqtt. zero for polled meters
+}
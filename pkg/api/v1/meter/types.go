@@ -8,14 +8,39 @@ type Data struct {
 	Id          string    `json:"id"`
 	Model       string    `json:"model"`
 	Time        time.Time `json:"time"`
-	Current_W   float64   `json:"w,omitempty"`
+	Current_W   float64   `json:"w,omitempty"` // electricity meters measuring both directions report import minus export
 	Current_VLL float64   `json:"vll,omitempty"`
 	Current_VLN float64   `json:"vln,omitempty"`
-	Total_WH    float64   `json:"wh,omitempty"`
+	Total_WH    float64   `json:"wh,omitempty"` // electricity meters report imported energy
 	L1_A        float64   `json:"l1_a,omitempty"`
 	L2_A        float64   `json:"l2_a,omitempty"`
 	L3_A        float64   `json:"l3_a,omitempty"`
 	L1_V        float64   `json:"l1_v,omitempty"`
 	L2_V        float64   `json:"l2_v,omitempty"`
 	L3_V        float64   `json:"l3_v,omitempty"`
+
+	// Electricity meters. Export is power and energy delivered to the grid.
+	// Import and export are only filled by sources which report the direction: p1, p1ib, mbus and wmbus
+	// records marked as export by the VIFE and mqtt generic meters mapping them. hogforsgst fills
+	// Import_W since the heat pump only consumes.
+	Import_W  float64 `json:"import_w,omitempty"`
+	Export_W  float64 `json:"export_w,omitempty"`
+	Export_WH float64 `json:"export_wh,omitempty"`
+	L1_W      float64 `json:"l1_w,omitempty"` // import minus export per phase
+	L2_W      float64 `json:"l2_w,omitempty"`
+	L3_W      float64 `json:"l3_w,omitempty"`
+
+	// Reactive power is import minus export like Current_W.
+	Reactive_VAR         float64 `json:"var,omitempty"`
+	L1_VAR               float64 `json:"l1_var,omitempty"`
+	L2_VAR               float64 `json:"l2_var,omitempty"`
+	L3_VAR               float64 `json:"l3_var,omitempty"`
+	Reactive_Import_VARH float64 `json:"import_varh,omitempty"`
+	Reactive_Export_VARH float64 `json:"export_varh,omitempty"`
+
+	// Heat meters use Current_W and Total_WH for thermal power and energy.
+	Volume_M3 float64 `json:"m3,omitempty"`
+	Flow_M3H  float64 `json:"m3h,omitempty"`
+	Supply_C  float64 `json:"supply_c,omitempty"`
+	Return_C  float64 `json:"return_c,omitempty"`
 }
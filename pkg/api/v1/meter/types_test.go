@@ -0,0 +1,14 @@
+package meter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataJSONBackwardsCompatible(t *testing.T) {
+	b, err := json.Marshal(&Data{Id: "1", Model: "p1ib", Current_W: 100, Total_WH: 2000})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1","model":"p1ib","time":"0001-01-01T00:00:00Z","w":100,"wh":2000}`, string(b))
+}
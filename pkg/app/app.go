@@ -4,41 +4,80 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/goburrow/modbus"
-	mqttv2 "github.com/mochi-mqtt/server/v2"
-	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
 	"github.com/nergy-se/controller/pkg/alarm"
 	v1config "github.com/nergy-se/controller/pkg/api/v1/config"
 	"github.com/nergy-se/controller/pkg/api/v1/meter"
 	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/backup"
 	"github.com/nergy-se/controller/pkg/controller"
 	"github.com/nergy-se/controller/pkg/controller/dummy"
 	"github.com/nergy-se/controller/pkg/controller/hogforsgst"
+	"github.com/nergy-se/controller/pkg/controller/registry"
 	"github.com/nergy-se/controller/pkg/controller/thermiagenesis"
 	"github.com/nergy-se/controller/pkg/mbus"
+	"github.com/nergy-se/controller/pkg/meterpoll"
 	"github.com/nergy-se/controller/pkg/modbusclient"
 	"github.com/nergy-se/controller/pkg/mqtt"
+	"github.com/nergy-se/controller/pkg/override"
+	"github.com/nergy-se/controller/pkg/p1"
+	"github.com/nergy-se/controller/pkg/queue"
 	"github.com/nergy-se/controller/pkg/state"
+	"github.com/nergy-se/controller/pkg/wmbus"
 	"github.com/sirupsen/logrus"
 )
 
+const backupURL = "api/controller/backup-v1"
+
 var httpClient = &http.Client{
 	Timeout: time.Second * 30,
 }
 
 type postRequest struct {
-	url  string
-	body []byte
+	method string // empty means POST
+	url    string
+	body   []byte
+}
+
+func (r *postRequest) httpMethod() string {
+	if r.method == "" {
+		return http.MethodPost
+	}
+	return r.method
+}
+
+// encode stores the request in the send queue as the url and the body separated by newline.
+// Other methods than POST are stored before the url separated by space.
+func (r *postRequest) encode() []byte {
+	line := r.url
+	if r.method != "" && r.method != http.MethodPost {
+		line = r.method + " " + r.url
+	}
+	return append([]byte(line+"\n"), r.body...)
+}
+
+func decodePostRequest(b []byte) (*postRequest, error) {
+	line, body, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return nil, fmt.Errorf("invalid queued request")
+	}
+	req := &postRequest{url: string(line), body: body}
+	if method, u, ok := strings.Cut(req.url, " "); ok {
+		req.method, req.url = method, u
+	}
+	return req, nil
 }
 
 type App struct {
@@ -47,34 +86,74 @@ type App struct {
 	cloudConfig *v1config.CloudConfig
 	cliConfig   *v1config.CliConfig
 
-	controller controller.Controller
-	mbusClient *mbus.Mbus
+	controller   controller.Controller
+	modbusClient modbus.Client // used for backup/restore. nil if controller does not use modbus
+	mbusBuses    *mbus.Buses
+	wmbus        map[string]*wmbus.Receiver
+	wmbusMutex   sync.Mutex
+	p1           map[string]*p1.Reader
+	p1Mutex      sync.Mutex
+	meterHealth  *meterpoll.Tracker
+	// indoorReadings are the last indoor temperatures per meter. Reused on ticks when the meter is not due.
+	indoorReadings map[string]*meterReading
 
 	activeAlarms *alarm.ActiveAlarms
-
-	sendQueue chan *postRequest
+	overrides    *override.Overrides
+	// controlSuspended is set after a backup is restored so the pump keeps its original settings.
+	controlSuspended atomic.Bool
+	// overridesChanged makes controllerLoop reconcile and report overrides.
+	overridesChanged chan struct{}
+	alarms           []string // alarms from the last check
+
+	sendQueue *queue.Queue
+	batch     *batch // telemetry uploaded together every metrics tick
+	// batchUnsupportedUntil is unix nanoseconds until the batch endpoint is tried again after a 404.
+	batchUnsupportedUntil atomic.Int64
+	// batchLimit and batchRejections are only used by retryLoop. batchLimit is lowered when the server
+	// answers 413 and batchRejections counts client errors for the batch at the start of the queue.
+	batchLimit      int
+	batchRejections int
 
 	ctx            context.Context
 	stopController context.CancelFunc
 
-	mqttServer *mqttv2.Server
-	meterCache *meter.Cache
-	stateCache *state.Cache
+	mqttServer        mqtt.Broker // embedded broker or client connected to MqttBroker
+	stopMQTT          context.CancelFunc
+	mqttWg            sync.WaitGroup // broker goroutines. separate from wg so a restart can wait for them
+	mqttSubscriptions *mqtt.Subscriptions
+	mqttLedger        *auth.Ledger
+	// genericMeters and roomSensors are keyed by config.Meter.Identifier.
+	genericMeters   map[string]*mqtt.GenericMeter
+	roomSensors     map[string]*mqtt.RoomSensor
+	mqttMetersMutex sync.Mutex
+	// mqttPublisher publishes to local clients. nil if the broker is not running
+	mqttPublisher *mqtt.Publisher
+	meterCache    *meter.Cache
+	stateCache    *state.Cache
 
 	metricsTicker time.Duration
 }
 
 func New(config *v1config.CliConfig) *App {
 	return &App{
-		wg:            &sync.WaitGroup{},
-		cliConfig:     config,
-		schedule:      v1config.NewConfig(),
-		activeAlarms:  &alarm.ActiveAlarms{},
-		mbusClient:    mbus.New(),
-		sendQueue:     make(chan *postRequest, 20000),
-		meterCache:    &meter.Cache{},
-		stateCache:    &state.Cache{},
-		metricsTicker: time.Second * 30,
+		wg:               &sync.WaitGroup{},
+		cliConfig:        config,
+		schedule:         v1config.NewConfig(),
+		activeAlarms:     &alarm.ActiveAlarms{},
+		overrides:        override.New(),
+		overridesChanged: make(chan struct{}, 1),
+		mbusBuses:        mbus.NewBuses(config.MbusDevice, config.MbusBaudRate),
+		wmbus:            make(map[string]*wmbus.Receiver),
+		p1:               make(map[string]*p1.Reader),
+		genericMeters:    make(map[string]*mqtt.GenericMeter),
+		roomSensors:      make(map[string]*mqtt.RoomSensor),
+		meterHealth:      meterpoll.NewTracker(),
+		indoorReadings:   make(map[string]*meterReading),
+		meterCache:       &meter.Cache{},
+		batch:            &batch{},
+		batchLimit:       maxBatchItems,
+		stateCache:       &state.Cache{},
+		metricsTicker:    time.Second * 30,
 	}
 }
 
@@ -111,7 +190,14 @@ func (a *App) sendCurrentSettings() {
 
 func (a *App) Start(ctx context.Context) error {
 	a.ctx = ctx
-	err := a.setupInitialConfig()
+	var err error
+	a.sendQueue, err = queue.Open(a.cliConfig.QueueFile, a.cliConfig.QueueMaxSize, a.cliConfig.QueueSyncInterval)
+	if err != nil {
+		return err
+	}
+	a.sendQueue.Start(ctx, a.wg)
+
+	err = a.setupInitialConfig()
 	if err != nil {
 		return err
 	}
@@ -127,36 +213,106 @@ func (a *App) Start(ctx context.Context) error {
 	a.wg.Add(1)
 	go a.controllerLoop(ctx)
 
-	go func() {
-		for {
+	a.wg.Add(1)
+	go a.retryLoop(ctx)
+	return nil
+}
+
+// retryLoop resends queued requests in batches. If the server does not support batches requests
+// are sent one by one and requests which fail again are moved to the end of the queue.
+func (a *App) retryLoop(ctx context.Context) {
+	defer a.wg.Done()
+	for {
+		if a.sendQueue.Len() == 0 {
+			a.batchLimit = maxBatchItems
 			select {
 			case <-ctx.Done():
 				return
-			case req := <-a.sendQueue:
-				if ctx.Err() != nil {
-					return
-				}
-				code, err := a.do(req.url, http.MethodPost, nil, bytes.NewBuffer(req.body), nil, true) // dont check x-fetch on retries.
+			case <-a.sendQueue.Notify():
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
 
-				if err != nil {
-					logrus.Errorf("error POST retry %s: %s", req.url, err)
-				}
-				if code != 200 {
-					logrus.Warnf("error retrying %s: %d adding to retry queue again", req.url, code)
-					select {
-					case a.sendQueue <- &postRequest{
-						url:  req.url,
-						body: req.body,
-					}:
-					default:
-						logrus.Error(fmt.Errorf("%w %w", err, ErrQueueFull))
-					}
-					time.Sleep(time.Second * 10)
-				}
+		var ok bool
+		if a.batchUnsupported() {
+			ok = a.retryOne()
+		} else {
+			ok = a.retryBatch()
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second * 10):
 			}
 		}
-	}()
-	return nil
+	}
+}
+
+// retryBatch sends the requests at the start of the queue. Batches the server answers 413 for are
+// split in half and batches it keeps rejecting with client errors are dropped so they do not
+// block the queue forever.
+func (a *App) retryBatch() bool {
+	reqs, n := a.takeBatch(a.batchLimit)
+	if len(reqs) > 0 {
+		code, err := a.sendBatch(reqs, true) // dont check x-fetch on retries.
+		switch {
+		case code == http.StatusNotFound:
+			return true // retried one by one
+		case code == http.StatusRequestEntityTooLarge && n > 1:
+			a.batchLimit = n / 2
+			logrus.Warnf("%s: %d retrying %d requests in batches of %d", batchURL, code, n, a.batchLimit)
+			return true
+		case rejected(code):
+			a.batchRejections++
+			if code != http.StatusRequestEntityTooLarge && a.batchRejections < maxBatchRejections {
+				logrus.Warnf("error retrying %d requests: %d rejected %d times: %v", len(reqs), code, a.batchRejections, err)
+				return false
+			}
+			logrus.Errorf("dropping %d requests rejected by %s: %d: %v", len(reqs), batchURL, code, err)
+		case code != http.StatusOK:
+			logrus.Warnf("error retrying %d requests: %d: %v", len(reqs), code, err)
+			return false
+		}
+	}
+	a.batchRejections = 0
+	a.popQueue(n)
+	return true
+}
+
+func (a *App) retryOne() bool {
+	data, ok := a.sendQueue.Peek()
+	if !ok {
+		return true
+	}
+	req, err := decodePostRequest(data)
+	if err != nil {
+		logrus.Error(err)
+		a.popQueue(1)
+		return true
+	}
+	code, err := a.do(req.url, req.httpMethod(), nil, bytes.NewBuffer(req.body), nil, true) // dont check x-fetch on retries.
+	if err != nil {
+		logrus.Errorf("error %s retry %s: %s", req.httpMethod(), req.url, err)
+	}
+	a.popQueue(1)
+	if code != http.StatusOK {
+		logrus.Warnf("error retrying %s: %d adding to retry queue again", req.url, code)
+		if err := a.sendQueue.Push(data); err != nil {
+			logrus.Errorf("error queueing %s: %s", req.url, err)
+		}
+		return false
+	}
+	return true
+}
+
+func (a *App) popQueue(n int) {
+	if err := a.sendQueue.PopN(n); err != nil {
+		logrus.Errorf("error removing requests from queue: %s", err)
+	}
 }
 
 func (a *App) setupInitialConfig() error {
@@ -183,10 +339,12 @@ func (a *App) setupInitialConfig() error {
 		return err
 	}
 	a.cloudConfig = cloudConfig
-	err = a.StartMQTTServer(a.ctx) //TODO we use parent context here so if we would like to react on changed mqtt config we need to use ctx to it gets restarted.
+	err = a.StartMQTTServer(a.ctx)
 	if err != nil {
 		return err
 	}
+	a.setupWmbus()
+	a.setupP1()
 
 	return nil
 }
@@ -202,10 +360,12 @@ func (a *App) syncCloudConfig(fromXFetch string) error {
 
 	*a.cloudConfig = *cloudConfig
 
-	err = a.StartMQTTServer(a.ctx) //TODO we use parent context here so if we would like to react on changed mqtt config we need to use ctx to it gets restarted.
+	err = a.StartMQTTServer(a.ctx)
 	if err != nil {
 		return err
 	}
+	a.setupWmbus()
+	a.setupP1()
 
 	if needsSetupController {
 		err = a.setupController(a.ctx)
@@ -214,7 +374,7 @@ func (a *App) syncCloudConfig(fromXFetch string) error {
 		}
 	}
 
-	if cloudConfig.HeatCurveControlEnabled {
+	if cloudConfig.HeatCurveControlEnabled && !a.controlSuspended.Load() {
 		if heatCurveDiff && a.cloudConfig.HeatCurve != nil {
 			err = a.controller.SetHeatCurve(a.cloudConfig.HeatCurve, a.cloudConfig.HeatCurveAdjust)
 			if err != nil {
@@ -238,18 +398,22 @@ func (a *App) setupController(pCtx context.Context) error {
 	}
 	var ctx context.Context
 	ctx, a.stopController = context.WithCancel(pCtx)
+	a.modbusClient = nil
 
 	switch a.cloudConfig.HeatControlType {
 	case types.HeatControlTypeThermiaGenesis:
 		handler := modbus.NewTCPClientHandler(a.cloudConfig.Address)
+		handler.SlaveId = registry.SlaveID(a.cloudConfig.HeatControlType)
 		client := modbus.NewClient(handler)
+		a.modbusClient = client
 		a.controller = thermiagenesis.New(modbusclient.New(client, handler.Close), false, a.cloudConfig)
 		logrus.Debug("configured controller thermiagenesis")
 
 	case types.HeatControlTypeHogforsGST:
 		handler := modbus.NewTCPClientHandler(a.cloudConfig.Address)
-		handler.SlaveId = 1
+		handler.SlaveId = registry.SlaveID(a.cloudConfig.HeatControlType)
 		client := modbus.NewClient(handler)
+		a.modbusClient = client
 		a.controller = hogforsgst.New(modbusclient.New(client, handler.Close), a.cloudConfig)
 		logrus.Debug("configured controller hogforsgst")
 
@@ -258,53 +422,510 @@ func (a *App) setupController(pCtx context.Context) error {
 		logrus.Debug("configured controller dummy")
 	}
 
+	// Must be done before reconcile so we get the original settings of the pump
+	err := a.backupSettings()
+	if err != nil {
+		logrus.Errorf("error backupSettings: %s", err.Error())
+	}
+
+	a.controlSuspended.Store(a.backupRestored())
+	if a.controlSuspended.Load() {
+		logrus.Info("control is suspended since the backup was restored")
+	}
+
 	// We must reconcile after controller has been setup otherwise allow values in state can mismatch
 	a.DoReconcile()
 	return nil
 }
 
+// backupSettings saves the original pump settings to BackupFile and uploads them to cloud.
+// It is only done once per controller type so we always keep the settings from before we took control.
+// A failed upload is added to the retry queue. The backup is uploaded again on next setup if that failed too.
+func (a *App) backupSettings() error {
+	registers := registry.Registers(a.cloudConfig.HeatControlType)
+	if a.cliConfig.BackupFile == "" || registers == nil || a.modbusClient == nil {
+		return nil
+	}
+	b, err := backup.Load(a.cliConfig.BackupFile)
+	if err == nil && b.Controller == a.cloudConfig.HeatControlType {
+		if b.Uploaded {
+			return nil
+		}
+	} else {
+		b, err = backup.Create(a.modbusClient, a.cloudConfig.HeatControlType, registers)
+		if err != nil {
+			return err
+		}
+		err = b.Save(a.cliConfig.BackupFile)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("saved backup of %d registers to %s", len(b.Registers), a.cliConfig.BackupFile)
+	}
+
+	body, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	_, err = a.do(backupURL, http.MethodPost, nil, bytes.NewBuffer(body), nil, true)
+	if err != nil {
+		logrus.Warnf("error uploading backup adding to retry queue: %s", err)
+		req := &postRequest{url: backupURL, body: body}
+		if err := a.sendQueue.Push(req.encode()); err != nil {
+			return fmt.Errorf("error queueing backup: %w", err)
+		}
+	}
+	b.Uploaded = true
+	return b.Save(a.cliConfig.BackupFile)
+}
+
+// backupRestored returns true if the local backup for the current controller has been restored.
+func (a *App) backupRestored() bool {
+	if a.cliConfig.BackupFile == "" {
+		return false
+	}
+	b, err := backup.Load(a.cliConfig.BackupFile)
+	return err == nil && b.Controller == a.cloudConfig.HeatControlType && b.Restored != nil
+}
+
+// setRestored marks the backup as restored or not and suspends or resumes control.
+func (a *App) setRestored(b *backup.Backup, restored bool) error {
+	a.controlSuspended.Store(restored)
+	b.Restored = nil
+	if restored {
+		now := time.Now()
+		b.Restored = &now
+	}
+	if a.cliConfig.BackupFile == "" {
+		return nil
+	}
+	return b.Save(a.cliConfig.BackupFile)
+}
+
+// restoreBackup fetches the backup from cloud and writes it to the pump.
+func (a *App) restoreBackup() error {
+	if a.modbusClient == nil {
+		return fmt.Errorf("controller %s does not support restore", a.cloudConfig.HeatControlType)
+	}
+	b := &backup.Backup{}
+	header := make(http.Header)
+	header.Set("x-fetch", "RestoreBackup")
+	_, err := a.do(backupURL, "GET", b, nil, header, true)
+	if err != nil {
+		return err
+	}
+	if b.Controller != a.cloudConfig.HeatControlType {
+		return fmt.Errorf("backup is for %s but controller is %s", b.Controller, a.cloudConfig.HeatControlType)
+	}
+	err = backup.Restore(a.modbusClient, b)
+	if err != nil {
+		return err
+	}
+	b.Uploaded = true // it came from cloud
+	logrus.Info("backup restored. control is suspended until resumed from cloud")
+	return a.setRestored(b, true)
+}
+
+// resumeControl lets reconcile control the pump again after a restore.
+func (a *App) resumeControl() error {
+	b := &backup.Backup{Controller: a.cloudConfig.HeatControlType, Version: backup.Version}
+	if a.cliConfig.BackupFile != "" {
+		old, err := backup.Load(a.cliConfig.BackupFile)
+		if err == nil {
+			b = old
+		}
+	}
+	err := a.setRestored(b, false)
+	if err != nil {
+		return err
+	}
+	logrus.Info("control resumed")
+	a.DoReconcile()
+	return nil
+}
+
+// scanMbus scans the default bus and all buses with configured mbus meters and reports the found devices.
+func (a *App) scanMbus() {
+	buses := make(map[*mbus.Mbus]bool)
+	meters := append([]v1config.Meter{{InterfaceType: "mbus"}}, a.cloudConfig.Meters...) // always scan the default bus
+	for _, m := range meters {
+		if m.InterfaceType != "mbus" {
+			continue
+		}
+		bus, err := a.mbusBuses.Get(m.Address, m.BaudRate)
+		if err != nil {
+			logrus.Errorf("error mbus scan: %s", err)
+			continue
+		}
+		buses[bus] = true
+	}
+
+	var results []mbus.ScanResult
+	for bus := range buses {
+		result := mbus.ScanResult{Device: bus.Device()}
+		devices, err := bus.Scan()
+		if err != nil {
+			logrus.Errorf("error scanning mbus %s: %s", bus.Device(), err)
+			result.Error = err.Error()
+		}
+		result.Devices = devices
+		results = append(results, result)
+	}
+
+	body, err := json.Marshal(results)
+	if err != nil {
+		logrus.Errorf("error marshal mbus scan: %s", err)
+		return
+	}
+	err = a.postWithRetry("api/controller/mbus-scan-v1", body)
+	if err != nil {
+		logrus.Errorf("error POST mbus scan: %s", err)
+	}
+}
+
+// setupWmbus starts one receiver per device and updates the meter keys.
+// Removed meters are forgotten and receivers without meters are stopped.
+func (a *App) setupWmbus() {
+	ids := make(map[string][]string) // per device
+	for _, m := range a.cloudConfig.Meters {
+		if m.InterfaceType != "wmbus" {
+			continue
+		}
+		r := a.wmbusReceiver(m)
+		ids[r.Device()] = append(ids[r.Device()], m.PrimaryID)
+		err := r.SetKey(m.PrimaryID, m.Key)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+
+	a.wmbusMutex.Lock()
+	defer a.wmbusMutex.Unlock()
+	for device, r := range a.wmbus {
+		if _, ok := ids[device]; !ok {
+			logrus.Infof("stopping unused wmbus receiver %s", device)
+			r.Stop()
+			delete(a.wmbus, device)
+			continue
+		}
+		r.Retain(ids[device])
+	}
+}
+
+func (a *App) wmbusReceiver(m v1config.Meter) *wmbus.Receiver {
+	device := m.Address
+	if device == "" {
+		device = a.cliConfig.WmbusDevice
+	}
+	a.wmbusMutex.Lock()
+	defer a.wmbusMutex.Unlock()
+	r, ok := a.wmbus[device]
+	if !ok {
+		baudRate := m.BaudRate
+		if baudRate == 0 {
+			baudRate = a.cliConfig.WmbusBaudRate
+		}
+		r = wmbus.New(device, baudRate)
+		r.Start(a.ctx, a.wg)
+		a.wmbus[device] = r
+	}
+	return r
+}
+
+// setupP1 starts reading the P1/HAN ports so a telegram is received before the first read.
+// Ports no longer used by any meter are stopped.
+func (a *App) setupP1() {
+	used := make(map[string]bool)
+	for _, m := range a.cloudConfig.Meters {
+		if m.InterfaceType != "p1" {
+			continue
+		}
+		r, err := a.p1Reader(m)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		used[r.Device()] = true
+	}
+
+	a.p1Mutex.Lock()
+	defer a.p1Mutex.Unlock()
+	for device, r := range a.p1 {
+		if !used[device] {
+			logrus.Infof("stopping unused p1 port %s", device)
+			r.Stop()
+			delete(a.p1, device)
+		}
+	}
+}
+
+func (a *App) p1Reader(m v1config.Meter) (*p1.Reader, error) {
+	device := m.Address
+	if device == "" {
+		device = a.cliConfig.P1Device
+	}
+	if device == "" {
+		return nil, fmt.Errorf("p1 meter %s has no address and no default p1 device is configured", m.Identifier())
+	}
+	a.p1Mutex.Lock()
+	defer a.p1Mutex.Unlock()
+	r, ok := a.p1[device]
+	if !ok {
+		baudRate := m.BaudRate
+		if baudRate == 0 {
+			baudRate = a.cliConfig.P1BaudRate
+		}
+		r = p1.New(device, baudRate)
+		r.Start(a.ctx, a.wg)
+		a.p1[device] = r
+	}
+	return r, nil
+}
+
 func (a *App) Wait() {
 	a.wg.Wait()
+	a.mqttWg.Wait()
 }
 
-// TODO start mqtt server if any mqtt config. then have separate function to do the Subscriptions based on whith meter (p1ib etc...)
+// StartMQTTServer starts or stops the broker depending on config and updates subscriptions
+// to match the configured mqtt meters. It is called every time the cloud config is synced.
 func (a *App) StartMQTTServer(ctx context.Context) error {
 	var err error
+	var users []mqtt.User
 	hasAnyMQTT := false
+	if a.cliConfig.MqttUsername != "" {
+		read := []string{a.cliConfig.MqttPrefix}
+		if a.cliConfig.MqttDiscoveryPrefix != "" {
+			read = append(read, a.cliConfig.MqttDiscoveryPrefix)
+		}
+		users = append(users, mqtt.User{
+			Username: a.cliConfig.MqttUsername,
+			Password: a.cliConfig.MqttPassword,
+			Read:     read,
+			Write:    []string{a.cliConfig.MqttPrefix + "/set"},
+		})
+		hasAnyMQTT = true
+	}
+	ledger := mqtt.NewLedger(a.cloudConfig.Meters, users...)
+	if a.mqttLedger != nil {
+		mqtt.UpdateLedger(a.mqttLedger, ledger)
+	} else {
+		a.mqttLedger = ledger
+	}
 	for _, m := range a.cloudConfig.Meters {
 		if m.InterfaceType == "mqtt" {
 			hasAnyMQTT = true
-			if a.mqttServer == nil {
-				a.mqttServer, err = mqtt.Start(ctx, a.wg)
+		}
+	}
+	if a.cliConfig.MqttBroker != "" {
+		hasAnyMQTT = true
+	}
+
+	if !hasAnyMQTT {
+		a.stopMQTTServer()
+		return nil
+	}
+
+	if a.mqttServer == nil {
+		mqttCtx, cancel := context.WithCancel(ctx)
+		a.mqttServer, err = a.startMQTTBroker(mqttCtx)
+		if err != nil {
+			cancel()
+			return err
+		}
+		a.stopMQTT = cancel
+		a.mqttSubscriptions = mqtt.NewSubscriptions(a.mqttServer)
+		var ha *mqtt.HomeAssistant
+		if a.cliConfig.MqttDiscoveryPrefix != "" {
+			ha = &mqtt.HomeAssistant{
+				DiscoveryPrefix: a.cliConfig.MqttDiscoveryPrefix,
+				ID:              a.cliConfig.SerialID(),
+			}
+		}
+		a.mqttPublisher = mqtt.NewPublisher(a.mqttServer, a.cliConfig.MqttPrefix, ha)
+		err = a.mqttServer.Subscribe(a.cliConfig.MqttPrefix+"/set/+", func(topic string, payload []byte) {
+			kind, err := override.ParseKind(path.Base(topic))
+			if err != nil {
+				logrus.Errorf("error mqtt command %s: %s", topic, err)
+				return
+			}
+			d, err := override.ParseDuration(string(payload))
+			if err != nil {
+				logrus.Errorf("error mqtt command %s: %s", topic, err)
+				return
+			}
+			err = a.SetOverride(kind, d)
+			if err != nil {
+				logrus.Errorf("error mqtt command %s: %s", topic, err)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.mqttSubscriptions.Update(a.cloudConfig.Meters, a.mqttMeterHandlers)
+	if err != nil {
+		logrus.Errorf("error updating mqtt subscriptions: %s", err)
+	}
+	a.pruneMQTTMeters(a.cloudConfig.Meters)
+
+	err = a.mqttPublisher.PublishDiscovery(string(a.cloudConfig.HeatControlType))
+	if err != nil {
+		logrus.Errorf("error publishing home assistant discovery: %s", err)
+	}
+	return nil
+}
+
+// stopMQTTServer closes the broker so it can be started again.
+func (a *App) stopMQTTServer() {
+	if a.mqttServer == nil {
+		return
+	}
+	a.stopMQTT()
+	a.mqttWg.Wait() // the listeners must be closed before a new broker can bind the same address
+	a.mqttServer = nil
+	a.mqttPublisher = nil
+	a.mqttSubscriptions = nil
+	a.pruneMQTTMeters(nil)
+}
+
+func (a *App) publishMeter(data *meter.Data) {
+	if a.mqttPublisher == nil {
+		return
+	}
+	err := a.mqttPublisher.PublishMeter(data)
+	if err != nil {
+		logrus.Errorf("error publishing %s meter %s to mqtt: %s", data.Model, data.Id, err)
+	}
+}
+
+// startMQTTBroker connects to MqttBroker if set. Otherwise the embedded broker is started.
+func (a *App) startMQTTBroker(ctx context.Context) (mqtt.Broker, error) {
+	if a.cliConfig.MqttBroker != "" {
+		clientID := a.cliConfig.MqttBrokerClientID
+		if clientID == "" {
+			clientID = "nergy-" + a.cliConfig.SerialID()
+		}
+		logrus.Infof("using external mqtt broker %s", a.cliConfig.MqttBroker)
+		return mqtt.Connect(ctx, &a.mqttWg, mqtt.ClientOptions{
+			Broker:   a.cliConfig.MqttBroker,
+			ClientID: clientID,
+			Username: a.cliConfig.MqttBrokerUsername,
+			Password: a.cliConfig.MqttBrokerPassword,
+			CA:       a.cliConfig.MqttBrokerCA,
+		})
+	}
+	return mqtt.Start(ctx, &a.mqttWg, a.mqttLedger, mqtt.Options{
+		Address:          a.cliConfig.MqttAddress,
+		TLSAddress:       a.cliConfig.MqttTLSAddress,
+		TLSCert:          a.cliConfig.MqttTLSCert,
+		TLSKey:           a.cliConfig.MqttTLSKey,
+		WebsocketAddress: a.cliConfig.MqttWebsocketAddress,
+	})
+}
+
+// mqttMeterHandlers returns the handler for each topic of an mqtt meter.
+func (a *App) mqttMeterHandlers(m v1config.Meter) (map[string]mqtt.Handler, error) {
+	switch m.Model {
+	case "p1ib":
+		primaryID := m.PrimaryID
+		id := m.Identifier()
+		prefix, ok := mqtt.TopicPrefixes(a.cloudConfig.Meters)[id]
+		if !ok {
+			return nil, fmt.Errorf("topic prefix %s is used by another meter", mqtt.TopicPrefix(m))
+		}
+		return map[string]mqtt.Handler{
+			prefix + "/sensor_state": func(topic string, payload []byte) {
+				data := &mqtt.P1ib{}
+				err := json.Unmarshal(payload, data)
 				if err != nil {
-					return err
+					logrus.Errorf("error unmarshal p1ib payload: %s", err)
+					return
 				}
-				if m.Model == "p1ib" {
-					primaryID := m.PrimaryID
-					err := a.mqttServer.Subscribe("p1ib/sensor_state", 1, func(cl *mqttv2.Client, sub packets.Subscription, pk packets.Packet) {
-						data := &mqtt.P1ib{}
-						err := json.Unmarshal(pk.Payload, data)
-						if err != nil {
-							logrus.Errorf("error unmarshal p1ib payload: %s", err)
-							return
-						}
-
-						meterData := data.AsMeterData(primaryID)
-						meterData.Time = time.Now()
-						a.meterCache.Set(meterData)
-					})
-					if err != nil {
-						return err
-					}
+
+				meterData := data.AsMeterData(primaryID)
+				meterData.Time = time.Now()
+				a.meterCache.Set(id, meterData)
+			},
+		}, nil
+	case mqtt.GenericModel:
+		g, err := mqtt.NewGenericMeter(m)
+		if err != nil {
+			return nil, err
+		}
+		a.mqttMetersMutex.Lock()
+		a.genericMeters[m.Identifier()] = g
+		a.mqttMetersMutex.Unlock()
+		handlers := make(map[string]mqtt.Handler)
+		for _, topic := range g.Topics() {
+			handlers[topic] = func(topic string, payload []byte) {
+				err := g.Handle(topic, payload)
+				if err != nil {
+					logrus.Errorf("error generic mqtt meter %s: %s", m.Identifier(), err)
 				}
 			}
 		}
+		return handlers, nil
+	case mqtt.RoomSensorModel:
+		r := mqtt.NewRoomSensor(m)
+		a.mqttMetersMutex.Lock()
+		a.roomSensors[m.Identifier()] = r
+		a.mqttMetersMutex.Unlock()
+		return map[string]mqtt.Handler{
+			r.Topic(): func(topic string, payload []byte) {
+				err := r.Handle(payload)
+				if err != nil {
+					logrus.Errorf("error room sensor %s: %s", m.Identifier(), err)
+				}
+			},
+		}, nil
 	}
+	return nil, nil
+}
 
-	if !hasAnyMQTT && a.mqttServer != nil {
-		a.mqttServer.Close()
+// pruneMQTTMeters forgets cached data, generic meters and room sensors which are no longer configured.
+func (a *App) pruneMQTTMeters(meters []v1config.Meter) {
+	configured := make(map[string]bool)
+	for _, m := range meters {
+		configured[m.Identifier()] = true
+	}
+	a.meterCache.Prune(func(id string) bool {
+		return configured[id]
+	})
+	a.mqttMetersMutex.Lock()
+	defer a.mqttMetersMutex.Unlock()
+	for id := range a.genericMeters {
+		if !configured[id] {
+			delete(a.genericMeters, id)
+		}
+	}
+	for id := range a.roomSensors {
+		if !configured[id] {
+			delete(a.roomSensors, id)
+		}
+	}
+}
+
+// publishMQTT publishes state, current schedule and alarms for local home automation.
+func (a *App) publishMQTT() {
+	if a.mqttPublisher == nil {
+		return
+	}
+	err := a.mqttPublisher.PublishState(a.stateCache.Get())
+	if err != nil {
+		logrus.Errorf("error publishing state to mqtt: %s", err)
+	}
+	if current := a.schedule.Current(); current != nil {
+		err = a.mqttPublisher.PublishSchedule(current)
+		if err != nil {
+			logrus.Errorf("error publishing schedule to mqtt: %s", err)
+		}
+	}
+	err = a.mqttPublisher.PublishAlarms(a.alarms)
+	if err != nil {
+		logrus.Errorf("error publishing alarms to mqtt: %s", err)
 	}
-	return nil
 }
 
 func (a *App) controllerLoop(ctx context.Context) {
@@ -312,6 +933,7 @@ func (a *App) controllerLoop(ctx context.Context) {
 	delay := calculateNextDelay()
 	timer := time.NewTimer(delay)
 	a.doSendMetrics()
+	a.flushBatch()
 
 	scheduleTicker := time.NewTicker(time.Hour * 6)
 	refreshToken := time.NewTicker(time.Hour * 24)
@@ -322,9 +944,14 @@ func (a *App) controllerLoop(ctx context.Context) {
 		case <-metricsTicker.C:
 			a.doSendMetrics()
 			a.doSendAlarms()
+			a.flushBatch()
+			a.publishMQTT()
 		case <-timer.C:
 			a.DoReconcile()
 			timer.Reset(calculateNextDelay())
+		case <-a.overridesChanged:
+			a.DoReconcile()
+			a.doSendOverrides()
 		case <-scheduleTicker.C:
 			a.doUpdateSchedule()
 		case <-refreshToken.C:
@@ -356,6 +983,59 @@ func (a *App) doSendMetrics() {
 		}
 	}
 }
+
+// SetOverride forces kind on for d on top of the schedule. d <= 0 cancels it.
+// Returns an error if the controller does not follow the schedule flags the override changes.
+func (a *App) SetOverride(kind override.Kind, d time.Duration) error {
+	if d > 0 {
+		if err := a.overridesSupported(); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("override %s for %s", kind, d)
+	a.overrides.Set(kind, d)
+	a.notifyOverridesChanged()
+	if d > 0 {
+		time.AfterFunc(d, a.notifyOverridesChanged)
+	}
+	return nil
+}
+
+// overridesSupported returns an error if the controller decides without the flags overrides change,
+// for example when it is controlled only by price.
+func (a *App) overridesSupported() error {
+	if c, ok := a.controller.(controller.Overridable); ok && c.SupportsOverrides() {
+		return nil
+	}
+	return fmt.Errorf("controller %s does not support overrides in this mode", a.cloudConfig.HeatControlType)
+}
+
+func (a *App) notifyOverridesChanged() {
+	select {
+	case a.overridesChanged <- struct{}{}:
+	default: // already pending
+	}
+}
+
+func (a *App) doSendOverrides() {
+	overrides := a.overrides.Active()
+	if a.mqttPublisher != nil {
+		err := a.mqttPublisher.PublishOverrides(overrides)
+		if err != nil {
+			logrus.Errorf("error publishing overrides to mqtt: %s", err)
+		}
+	}
+	body, err := json.Marshal(overrides)
+	if err != nil {
+		logrus.Errorf("error marshal overrides: %s", err)
+		return
+	}
+	err = a.postWithRetry("api/controller/overrides-v1", body)
+	if err != nil {
+		logrus.Errorf("error POST overrides: %s", err)
+	}
+}
+
 func (a *App) doSendAlarms() {
 	err := a.sendAlarms()
 	if err != nil {
@@ -378,13 +1058,28 @@ func (a *App) doUpdateSchedule() {
 
 // reconcile makes sure heatpump are in desired state
 func (a *App) reconcile() error {
+	if a.controlSuspended.Load() {
+		logrus.Debug("reconcile skipped since control is suspended after restore")
+		return nil
+	}
+	// the controller mode can change after the override was set. cancel it so it is not reported as active.
+	if err := a.overridesSupported(); err != nil && len(a.overrides.Active()) > 0 {
+		logrus.Warnf("cancelling overrides: %s", err)
+		a.overrides.Clear()
+		a.notifyOverridesChanged()
+	}
+
 	logrus.Debug("reconcile heatpump")
-	current := a.schedule.Current()
+	scheduled := a.schedule.Current()
 
-	if current == nil {
+	if scheduled == nil {
 		return fmt.Errorf("no current schedule")
 	}
 
+	// work on a copy so overrides and rules below does not change the schedule
+	hour := a.overrides.Apply(*scheduled)
+	current := &hour
+
 	// indoor temp rules here
 
 	indoor := a.stateCache.Get().IndoorMin
@@ -424,6 +1119,11 @@ func (a *App) sendMetrics(stateOverride *state.State) error {
 	if stateOverride.IndoorMin != nil {
 		state.IndoorMin = stateOverride.IndoorMin
 	}
+	if stateOverride.IndoorMax != nil {
+		state.IndoorMax = stateOverride.IndoorMax
+	}
+	depth := a.sendQueue.Len()
+	state.QueueDepth = &depth
 	a.stateCache.Set(state)
 
 	body, err := json.Marshal(state)
@@ -431,11 +1131,11 @@ func (a *App) sendMetrics(stateOverride *state.State) error {
 		return err
 	}
 
-	err = a.postWithRetry("api/controller/metrics-v1", body)
-	return err
+	a.postBatched("api/controller/metrics-v1", body)
+	return nil
 }
 
-var ErrQueueFull = errors.New("queue full")
+var ErrQueueFull = queue.ErrFull
 
 func (a *App) sendMeterValues() *state.State {
 
@@ -447,80 +1147,255 @@ func (a *App) sendMeterValues() *state.State {
 		}
 
 		for _, data := range datas {
+			a.publishMeter(data)
 			body, err := json.Marshal(data)
 			if err != nil {
 				logrus.Errorf("error marshal %s meter %s: %s", data.Model, data.Id, err)
 				continue
 			}
-
-			err = a.postWithRetry("api/controller/meter-v1", body)
-			if err != nil {
-				logrus.Errorf("error POST %s meter %s: %s", data.Model, data.Id, err)
-				continue
-			}
+			a.postBatched("api/controller/meter-v1", body)
 		}
 	}
 
-outer:
-	for _, m := range a.cloudConfig.Meters {
-		var data *meter.Data
-		var err error
-		switch m.InterfaceType {
-		case "mbus":
-			data, err = a.mbusClient.ReadValues(m.Model, m.PrimaryID)
-			if err != nil {
-				logrus.Errorf("error fetching mbus meter %s: %s", m.PrimaryID, err)
-				continue
-			}
-		case "mqtt":
-			if m.Model == "p1ib" {
-				data = a.meterCache.Get()
+	var indoor indoorTemperatures
+	meters := a.cloudConfig.Meters
+	for _, m := range meters {
+		if !a.meterHealth.Due(m) {
+			if reading, ok := a.indoorReadings[m.Identifier()]; ok {
+				indoor.add(reading)
 			}
-		case "modbus-tcp":
-			if m.Model == "holdingreg-10scale-16bit" {
-
-				handler := modbus.NewTCPClientHandler(m.Address)
-				c := modbusclient.New(modbus.NewClient(handler), handler.Close)
-				id, _ := strconv.Atoi(m.PrimaryID)
-				var val int
-				val, err = c.ReadHoldingRegister16(uint16(id))
-				handler.Close()
-				if err != nil {
-					logrus.Errorf("error ReadHoldingRegister16 from address:%s id:%s", m.Address, m.PrimaryID)
-				}
-				if m.Position == "indoor_temp" || m.Position == "indoor_temp_min" { // indoor_temp is deprecated and can be removed once all controllers are updated
-					t := float64(val) / 10.0
-					state.IndoorMin = &t
-					continue outer // continue for loos since we have nothing to POST to meter-v1 here (send with controller metrics)
-				}
-				if m.Position == "indoor_temp_avg" {
-					t := float64(val) / 10.0
-					state.Indoor = &t
-					continue outer // continue for loos since we have nothing to POST to meter-v1 here (send with controller metrics)
-				}
-			}
-		default:
 			continue
 		}
-
-		if data == nil {
-			logrus.Errorf("empty data for meter %s: %s id: %s", m.InterfaceType, m.Model, m.PrimaryID)
+		reading, err := meterpoll.Retry(a.ctx, m.Retries, time.Duration(m.Timeout)*time.Second, func(ctx context.Context) (*meterReading, error) {
+			return a.readMeter(ctx, m)
+		})
+		if err != nil {
+			delete(a.indoorReadings, m.Identifier())
+			a.meterHealth.Failure(m, err)
+			logrus.Errorf("error fetching %s meter %s: %s", m.InterfaceType, m.Identifier(), err)
 			continue
 		}
+		a.meterHealth.Success(m)
+
+		if reading.indoor != nil || reading.indoorMin != nil {
+			a.indoorReadings[m.Identifier()] = reading
+		}
+		indoor.add(reading)
+		if reading.data == nil {
+			continue // nothing to POST to meter-v1 here (send with controller metrics)
+		}
+		a.publishMeter(reading.data)
 
-		body, err := json.Marshal(data)
+		body, err := json.Marshal(reading.data)
 		if err != nil {
 			logrus.Errorf("error marshal %s meter %s: %s", m.InterfaceType, m.PrimaryID, err)
 			continue
 		}
+		a.postBatched("api/controller/meter-v1", body)
+	}
+
+	// room sensors are aggregated every tick and not only when due so indoor temperatures do not flap.
+	indoor.temperatures = append(indoor.temperatures, a.roomTemperatures(meters)...)
+	indoor.apply(state)
+
+	if len(meters) > 0 {
+		health := a.meterHealth.Health(meters)
+		for i, m := range meters {
+			health[i].LastReceived = a.lastReceived(m)
+		}
+		body, err := json.Marshal(health)
+		if err != nil {
+			logrus.Errorf("error marshal meter health: %s", err)
+			return state
+		}
+		a.postBatched("api/controller/meter-health-v1", body)
+	}
+	return state
+}
 
-		err = a.postWithRetry("api/controller/meter-v1", body)
+// roomTemperatures returns the temperature of every configured room sensor which is not stale.
+func (a *App) roomTemperatures(meters []v1config.Meter) []float64 {
+	var rooms []float64
+	a.mqttMetersMutex.Lock()
+	defer a.mqttMetersMutex.Unlock()
+	for _, m := range meters {
+		if m.InterfaceType != "mqtt" || m.Model != mqtt.RoomSensorModel {
+			continue
+		}
+		r, ok := a.roomSensors[m.Identifier()]
+		if !ok {
+			continue
+		}
+		t, err := r.Temperature()
 		if err != nil {
-			logrus.Errorf("error POST %s meter %s: %s", m.InterfaceType, m.PrimaryID, err)
 			continue
 		}
+		rooms = append(rooms, t)
 	}
-	return state
+	return rooms
+}
+
+// meterReading is meter data to POST to meter-v1 or indoor temperatures which are sent with controller metrics.
+type meterReading struct {
+	data      *meter.Data
+	indoor    *float64
+	indoorMin *float64
+	room      *float64 // only checks health. room sensors are aggregated by roomTemperatures every tick
+}
+
+// indoorTemperatures combines the indoor readings of modbus meters and room sensors.
+// Indoor is the mean and IndoorMax the highest of indoor meters and room sensors. IndoorMin is
+// the lowest of those and of indoor_temp_min meters, which already report a minimum.
+type indoorTemperatures struct {
+	temperatures []float64
+	minimums     []float64
+}
+
+func (t *indoorTemperatures) add(r *meterReading) {
+	if r.indoor != nil {
+		t.temperatures = append(t.temperatures, *r.indoor)
+	}
+	if r.indoorMin != nil {
+		t.minimums = append(t.minimums, *r.indoorMin)
+	}
+}
+
+func (t *indoorTemperatures) apply(s *state.State) {
+	if len(t.temperatures) > 0 {
+		_, s.Indoor, s.IndoorMax = mqtt.AggregateTemperatures(t.temperatures)
+	}
+	if all := append(slices.Clone(t.temperatures), t.minimums...); len(all) > 0 {
+		lo := slices.Min(all)
+		s.IndoorMin = &lo
+	}
+}
+
+func (a *App) readMeter(ctx context.Context, m v1config.Meter) (*meterReading, error) {
+	var data *meter.Data
+	var err error
+	switch m.InterfaceType {
+	case "mbus":
+		var bus *mbus.Mbus
+		bus, err = a.mbusBuses.Get(m.Address, m.BaudRate)
+		if err == nil {
+			data, err = bus.ReadValues(ctx, m.Model, m.PrimaryID, m.SecondaryID)
+		}
+	case "wmbus":
+		data, err = a.wmbusReceiver(m).ReadValues(m.Model, m.PrimaryID)
+		if err == nil {
+			err = checkMaxAge(m, data.Time)
+		}
+	case "p1":
+		var r *p1.Reader
+		r, err = a.p1Reader(m)
+		if err == nil {
+			data, err = r.ReadValues(m.Model, m.PrimaryID)
+		}
+		if err == nil {
+			err = checkMaxAge(m, data.Time)
+		}
+	case "mqtt":
+		if m.Model == "p1ib" {
+			data = a.meterCache.Get(m.Identifier())
+			if data != nil {
+				err = checkMaxAge(m, a.meterCache.LastReceived(m.Identifier()))
+			}
+		}
+		if m.Model == mqtt.GenericModel {
+			a.mqttMetersMutex.Lock()
+			g, ok := a.genericMeters[m.Identifier()]
+			a.mqttMetersMutex.Unlock()
+			if !ok {
+				return nil, fmt.Errorf("generic mqtt meter %s is not subscribed", m.Identifier())
+			}
+			data, err = g.Data()
+			if err == nil && data != nil {
+				err = checkMaxAge(m, data.Time)
+			}
+		}
+		if m.Model == mqtt.RoomSensorModel {
+			a.mqttMetersMutex.Lock()
+			r, ok := a.roomSensors[m.Identifier()]
+			a.mqttMetersMutex.Unlock()
+			if !ok {
+				return nil, fmt.Errorf("room sensor %s is not subscribed", m.Identifier())
+			}
+			t, err := r.Temperature()
+			if err != nil {
+				return nil, err
+			}
+			return &meterReading{room: &t}, nil
+		}
+	case "modbus-tcp":
+		if m.Model == "holdingreg-10scale-16bit" {
+			handler := modbus.NewTCPClientHandler(m.Address)
+			if deadline, ok := ctx.Deadline(); ok {
+				handler.Timeout = time.Until(deadline)
+			}
+			c := modbusclient.New(modbus.NewClient(handler), handler.Close)
+			id, _ := strconv.Atoi(m.PrimaryID)
+			var val int
+			val, err = c.ReadHoldingRegister16(uint16(id))
+			handler.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error ReadHoldingRegister16 from address:%s id:%s: %w", m.Address, m.PrimaryID, err)
+			}
+			t := float64(val) / 10.0
+			if m.Position == "indoor_temp" || m.Position == "indoor_temp_min" { // indoor_temp is deprecated and can be removed once all controllers are updated
+				return &meterReading{indoorMin: &t}, nil
+			}
+			if m.Position == "indoor_temp_avg" {
+				return &meterReading{indoor: &t}, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported interface type %s", m.InterfaceType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("empty data for meter %s: %s id: %s", m.InterfaceType, m.Model, m.PrimaryID)
+	}
+	return &meterReading{data: data}, nil
+}
+
+// lastReceived is when data was last received from an mqtt or p1 meter. Zero for other meters.
+func (a *App) lastReceived(m v1config.Meter) time.Time {
+	if m.InterfaceType == "p1" {
+		r, err := a.p1Reader(m)
+		if err != nil {
+			return time.Time{}
+		}
+		return r.LastReceived()
+	}
+	if m.InterfaceType != "mqtt" {
+		return time.Time{}
+	}
+	a.mqttMetersMutex.Lock()
+	defer a.mqttMetersMutex.Unlock()
+	switch m.Model {
+	case "p1ib":
+		return a.meterCache.LastReceived(m.Identifier())
+	case mqtt.GenericModel:
+		if g, ok := a.genericMeters[m.Identifier()]; ok {
+			return g.LastReceived()
+		}
+	case mqtt.RoomSensorModel:
+		if r, ok := a.roomSensors[m.Identifier()]; ok {
+			return r.LastReceived()
+		}
+	}
+	return time.Time{}
+}
+
+// checkMaxAge returns an error if data received from meter m is too old to be reported.
+func checkMaxAge(m v1config.Meter, received time.Time) error {
+	age := time.Since(received)
+	if age > mqtt.MaxAge(m) {
+		return fmt.Errorf("data from %s meter %s is stale: last received %s ago", m.Model, m.Identifier(), age.Round(time.Second))
+	}
+	return nil
 }
 
 func (a *App) sendAlarms() error {
@@ -528,12 +1403,13 @@ func (a *App) sendAlarms() error {
 	if err != nil {
 		return err
 	}
+	alarms = append(alarms, a.meterHealth.Alarms(a.cloudConfig.Meters)...)
+	a.alarms = alarms
 
 	if len(alarms) == 0 {
 		hadActive := a.activeAlarms.Clear()
 		if hadActive {
-			_, err := a.do("api/controller/alarms-v1", "DELETE", nil, nil, nil, true)
-			return err
+			a.sendOrdered(&postRequest{method: http.MethodDelete, url: "api/controller/alarms-v1"})
 		}
 		return nil
 	}
@@ -549,11 +1425,7 @@ func (a *App) sendAlarms() error {
 			continue
 		}
 
-		_, err = a.do("api/controller/alarm-v1", "POST", nil, bytes.NewBuffer(body), nil, true)
-		if err != nil {
-			logrus.Error(err)
-		}
-
+		a.postBatched("api/controller/alarm-v1", body)
 	}
 	return nil
 }
@@ -590,17 +1462,17 @@ func (a *App) fetchConfig(fromXFetch string) (*v1config.CloudConfig, error) {
 }
 
 func (a *App) postWithRetry(u string, body []byte) error {
-	code, err := a.do(u, http.MethodPost, nil, bytes.NewBuffer(body), nil, false)
+	return a.sendWithRetry(&postRequest{url: u, body: body})
+}
+
+// sendWithRetry sends req and adds it to the retry queue if it fails.
+func (a *App) sendWithRetry(req *postRequest) error {
+	code, err := a.do(req.url, req.httpMethod(), nil, bytes.NewBuffer(req.body), nil, false)
 
 	if code != 200 {
-		logrus.Warnf("error %s: %d adding to retry queue", u, code)
-		select {
-		case a.sendQueue <- &postRequest{
-			url:  u,
-			body: body,
-		}:
-		default:
-			return fmt.Errorf("%w %w", err, ErrQueueFull)
+		logrus.Warnf("error %s: %d adding to retry queue", req.url, code)
+		if qerr := a.sendQueue.Push(req.encode()); qerr != nil {
+			return fmt.Errorf("%w %w", err, qerr)
 		}
 	}
 
@@ -644,13 +1516,24 @@ func (a *App) do(u string, method string, dst any, body io.Reader, header http.H
 		keys := strings.Split(resp.Header.Get("x-fetch"), ",")
 		logrus.Debug("got x-fetch with keys: ", keys)
 		for _, key := range keys {
-			if key != "ControllerConfig" { //TODO when we need more of them
-				continue
-			}
-
-			err := a.syncCloudConfig(key)
-			if err != nil {
-				logrus.Errorf("error from syncCloudConfig: %s", err.Error())
+			switch key {
+			case "ControllerConfig":
+				err := a.syncCloudConfig(key)
+				if err != nil {
+					logrus.Errorf("error from syncCloudConfig: %s", err.Error())
+				}
+			case "RestoreBackup":
+				err := a.restoreBackup()
+				if err != nil {
+					logrus.Errorf("error from restoreBackup: %s", err.Error())
+				}
+			case "ResumeControl":
+				err := a.resumeControl()
+				if err != nil {
+					logrus.Errorf("error from resumeControl: %s", err.Error())
+				}
+			case "MbusScan":
+				go a.scanMbus()
 			}
 		}
 	}
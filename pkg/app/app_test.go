@@ -0,0 +1,301 @@
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1config "github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller/hogforsgst"
+	"github.com/nergy-se/controller/pkg/controller/thermiagenesis"
+	"github.com/nergy-se/controller/pkg/override"
+	"github.com/nergy-se/controller/pkg/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/tbrandon/mbserver"
+)
+
+// newMQTTApp starts the embedded broker without listeners for the configured meters.
+func newMQTTApp(t *testing.T, meters ...v1config.Meter) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := New(&v1config.CliConfig{MqttPrefix: "nergy", SerialFile: "/dev/null"})
+	a.ctx = ctx
+	a.cloudConfig = &v1config.CloudConfig{Meters: meters}
+	t.Cleanup(func() {
+		cancel()
+		a.Wait()
+	})
+	assert.NoError(t, a.StartMQTTServer(ctx))
+	return a
+}
+
+func TestGenericMQTTMeter(t *testing.T) {
+	m := v1config.Meter{
+		InterfaceType: "mqtt",
+		Model:         "generic",
+		PrimaryID:     "shelly",
+		Topic:         "shellies/em/status",
+		Fields: []v1config.FieldMapping{
+			{Path: "emeters.0.power", Field: "w"},
+			{Path: "emeters.0.total", Field: "wh"},
+		},
+	}
+	a := newMQTTApp(t, m)
+
+	assert.NoError(t, a.mqttServer.Publish("shellies/em/status", []byte(`{"emeters":[{"power":1234.5,"total":5000}]}`), false))
+	var reading *meterReading
+	assert.Eventually(t, func() bool {
+		var err error
+		reading, err = a.readMeter(context.Background(), m)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	if assert.NotNil(t, reading) {
+		assert.Equal(t, 1234.5, reading.data.Current_W)
+		assert.Equal(t, 5000.0, reading.data.Total_WH)
+		assert.Equal(t, "shelly", reading.data.Id)
+	}
+
+	// removing the meter forgets it
+	a.cloudConfig.Meters = nil
+	assert.NoError(t, a.StartMQTTServer(a.ctx))
+	_, err := a.readMeter(context.Background(), m)
+	assert.Error(t, err)
+}
+
+func TestRoomSensorsAggregatedEveryTick(t *testing.T) {
+	sensor := func(id string) v1config.Meter {
+		return v1config.Meter{InterfaceType: "mqtt", Model: "room-temperature", PrimaryID: id, PollInterval: 3600}
+	}
+	a := newMQTTApp(t, sensor("kitchen"), sensor("bedroom"))
+
+	assert.NoError(t, a.mqttServer.Publish("zigbee2mqtt/kitchen", []byte(`{"temperature":22}`), false))
+	assert.NoError(t, a.mqttServer.Publish("zigbee2mqtt/bedroom", []byte(`{"temperature":19}`), false))
+	assert.Eventually(t, func() bool {
+		return len(a.roomTemperatures(a.cloudConfig.Meters)) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ { // the second tick is before the sensors are due again
+		state := a.sendMeterValues()
+		if assert.NotNil(t, state.Indoor) {
+			assert.Equal(t, 19.0, *state.IndoorMin)
+			assert.Equal(t, 20.5, *state.Indoor)
+			assert.Equal(t, 22.0, *state.IndoorMax)
+		}
+	}
+}
+
+func TestIndoorReadingReusedWhenNotDue(t *testing.T) {
+	serv := mbserver.NewServer()
+	serv.HoldingRegisters[112] = 165
+	assert.NoError(t, serv.ListenTCP("127.0.0.1:2503"))
+	defer serv.Close()
+
+	a := New(&v1config.CliConfig{})
+	a.ctx = context.Background()
+	a.cloudConfig = &v1config.CloudConfig{Meters: []v1config.Meter{{
+		InterfaceType: "modbus-tcp",
+		Model:         "holdingreg-10scale-16bit",
+		Position:      "indoor_temp_min",
+		PrimaryID:     "112",
+		Address:       "127.0.0.1:2503",
+		PollInterval:  3600,
+	}}}
+
+	for i := 0; i < 2; i++ { // the second tick is before the meter is due again
+		state := a.sendMeterValues()
+		if assert.NotNil(t, state.IndoorMin) {
+			assert.Equal(t, 16.5, *state.IndoorMin)
+		}
+	}
+}
+
+func TestIndoorCombinesMetersAndRoomSensors(t *testing.T) {
+	serv := mbserver.NewServer()
+	serv.HoldingRegisters[112] = 165
+	serv.HoldingRegisters[113] = 210
+	assert.NoError(t, serv.ListenTCP("127.0.0.1:2504"))
+	defer serv.Close()
+
+	indoor := func(register, position string) v1config.Meter {
+		return v1config.Meter{
+			InterfaceType: "modbus-tcp",
+			Model:         "holdingreg-10scale-16bit",
+			Position:      position,
+			PrimaryID:     register,
+			Address:       "127.0.0.1:2504",
+			PollInterval:  3600,
+		}
+	}
+	a := newMQTTApp(t,
+		indoor("112", "indoor_temp_min"),
+		indoor("113", "indoor_temp_avg"),
+		v1config.Meter{InterfaceType: "mqtt", Model: "room-temperature", PrimaryID: "kitchen", PollInterval: 3600},
+	)
+	assert.NoError(t, a.mqttServer.Publish("zigbee2mqtt/kitchen", []byte(`{"temperature":24}`), false))
+	assert.Eventually(t, func() bool {
+		return len(a.roomTemperatures(a.cloudConfig.Meters)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ { // the second tick reuses the modbus readings
+		state := a.sendMeterValues()
+		if assert.NotNil(t, state.Indoor) && assert.NotNil(t, state.IndoorMin) && assert.NotNil(t, state.IndoorMax) {
+			assert.Equal(t, 16.5, *state.IndoorMin)
+			assert.Equal(t, 22.5, *state.Indoor)
+			assert.Equal(t, 24.0, *state.IndoorMax)
+		}
+	}
+}
+
+func TestPostRequestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *postRequest
+		want string
+	}{
+		{name: "post", req: &postRequest{url: "api/controller/alarm-v1", body: []byte(`"alarm"`)}, want: "api/controller/alarm-v1\n\"alarm\""},
+		{name: "delete", req: &postRequest{method: http.MethodDelete, url: "api/controller/alarms-v1"}, want: "DELETE api/controller/alarms-v1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.req.encode()
+			assert.Equal(t, tt.want, string(b))
+			req, err := decodePostRequest(b)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.req.httpMethod(), req.httpMethod())
+			assert.Equal(t, tt.req.url, req.url)
+			assert.Equal(t, string(tt.req.body), string(req.body))
+		})
+	}
+}
+
+func TestSendOrdered(t *testing.T) {
+	a := New(&v1config.CliConfig{})
+	var err error
+	a.sendQueue, err = queue.Open("", 0, 0)
+	assert.NoError(t, err)
+	clearAlarms := &postRequest{method: http.MethodDelete, url: "api/controller/alarms-v1"}
+
+	a.sendOrdered(clearAlarms) // nothing waiting for retry so it goes with the batch
+	assert.Len(t, a.batch.take(), 1)
+
+	assert.NoError(t, a.sendQueue.Push((&postRequest{url: "api/controller/alarm-v1", body: []byte(`"alarm"`)}).encode()))
+	a.sendOrdered(clearAlarms)
+	assert.Empty(t, a.batch.take())
+	items := a.sendQueue.PeekN(2)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "DELETE api/controller/alarms-v1\n", string(items[1]))
+	}
+}
+
+func TestBatchReprobe(t *testing.T) {
+	a := New(&v1config.CliConfig{})
+	assert.False(t, a.batchUnsupported())
+	a.batchUnsupportedUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	assert.True(t, a.batchUnsupported())
+	a.batchUnsupportedUntil.Store(time.Now().Add(-time.Minute).UnixNano())
+	assert.False(t, a.batchUnsupported())
+}
+
+// newBatchServer answers batch uploads with status and records the number of items in each.
+func newBatchServer(t *testing.T, status func(items []batchItem) int) (*App, *[]int) {
+	var sizes []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		var batch batchRequest
+		assert.NoError(t, json.NewDecoder(gz).Decode(&batch))
+		sizes = append(sizes, len(batch.Items))
+		w.WriteHeader(status(batch.Items))
+	}))
+	t.Cleanup(srv.Close)
+
+	a := New(&v1config.CliConfig{Server: srv.URL})
+	var err error
+	a.sendQueue, err = queue.Open("", 0, 0)
+	assert.NoError(t, err)
+	return a, &sizes
+}
+
+func TestRetryBatchSplitsTooLarge(t *testing.T) {
+	a, sizes := newBatchServer(t, func(items []batchItem) int {
+		if len(items) > 2 || string(items[0].Body) == `"big"` {
+			return http.StatusRequestEntityTooLarge
+		}
+		return http.StatusOK
+	})
+	for _, body := range []string{"1", "2", "3", "4", `"big"`} {
+		assert.NoError(t, a.sendQueue.Push((&postRequest{url: "api/controller/metrics-v1", body: []byte(body)}).encode()))
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, a.retryBatch())
+	}
+	assert.Equal(t, []int{5, 2, 2, 1}, *sizes) // the single request which is too large is dropped
+	assert.Equal(t, 0, a.sendQueue.Len())
+}
+
+func TestRetryBatchDropsRejected(t *testing.T) {
+	status := http.StatusUnauthorized
+	a, sizes := newBatchServer(t, func(items []batchItem) int {
+		return status
+	})
+	assert.NoError(t, a.sendQueue.Push((&postRequest{url: "api/controller/metrics-v1", body: []byte("1")}).encode()))
+
+	for i := 0; i < maxBatchRejections+1; i++ { // 401 can recover when the token is updated
+		assert.False(t, a.retryBatch())
+	}
+	assert.Equal(t, 1, a.sendQueue.Len())
+
+	status = http.StatusBadRequest
+	for i := 0; i < maxBatchRejections-1; i++ {
+		assert.False(t, a.retryBatch())
+		assert.Equal(t, 1, a.sendQueue.Len())
+	}
+	assert.True(t, a.retryBatch())
+	assert.Equal(t, 0, a.sendQueue.Len())
+	assert.Len(t, *sizes, 2*maxBatchRejections+1)
+}
+
+func TestMQTTServerRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := New(&v1config.CliConfig{MqttPrefix: "nergy", SerialFile: "/dev/null", MqttAddress: "127.0.0.1:18883"})
+	a.ctx = ctx
+	defer func() {
+		cancel()
+		a.Wait()
+	}()
+	room := v1config.Meter{InterfaceType: "mqtt", Model: "room-temperature", PrimaryID: "kitchen"}
+
+	for i := 0; i < 3; i++ { // the address is free again as soon as the broker is stopped
+		a.cloudConfig = &v1config.CloudConfig{Meters: []v1config.Meter{room}}
+		assert.NoError(t, a.StartMQTTServer(ctx))
+		a.cloudConfig = &v1config.CloudConfig{}
+		assert.NoError(t, a.StartMQTTServer(ctx))
+		assert.Nil(t, a.mqttServer)
+	}
+}
+
+func TestOverridesUnsupported(t *testing.T) {
+	a := New(&v1config.CliConfig{})
+	a.cloudConfig = &v1config.CloudConfig{HeatControlType: types.HeatControlTypeThermiaGenesis, DistrictHeatingPrice: 1.2}
+	a.controller = thermiagenesis.New(nil, false, a.cloudConfig)
+	assert.EqualError(t, a.SetOverride(override.Heating, time.Hour), "controller thermiagenesis does not support overrides in this mode")
+	assert.NoError(t, a.SetOverride(override.Heating, 0))
+	assert.Empty(t, a.overrides.Active())
+
+	a.cloudConfig.DistrictHeatingPrice = 0
+	assert.NoError(t, a.SetOverride(override.Heating, time.Hour))
+	assert.Len(t, a.overrides.Active(), 1)
+
+	// switching to price control cancels the override
+	a.cloudConfig.DistrictHeatingPrice = 1.2
+	assert.EqualError(t, a.reconcile(), "no current schedule")
+	assert.Empty(t, a.overrides.Active())
+
+	a.controller = hogforsgst.New(nil, a.cloudConfig)
+	assert.Error(t, a.SetOverride(override.Boost, time.Hour))
+}
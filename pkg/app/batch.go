@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	batchURL      = "api/controller/batch-v1"
+	maxBatchItems = 500
+	maxBatchSize  = 4 << 20 // uncompressed bytes
+
+	// batchReprobeInterval is how long requests are sent one by one after the server answered 404.
+	batchReprobeInterval = time.Hour
+
+	// maxBatchRejections is how many client errors a retried batch gets before it is dropped.
+	maxBatchRejections = 3
+)
+
+type batchItem struct {
+	Method string          `json:"method,omitempty"` // empty means POST
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchRequest struct {
+	Items []batchItem `json:"items"`
+}
+
+// batch collects the requests made during a metrics tick so they are uploaded together.
+type batch struct {
+	requests []*postRequest
+	mutex    sync.Mutex
+}
+
+func (b *batch) add(req *postRequest) {
+	b.mutex.Lock()
+	b.requests = append(b.requests, req)
+	b.mutex.Unlock()
+}
+
+func (b *batch) take() []*postRequest {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	reqs := b.requests
+	b.requests = nil
+	return reqs
+}
+
+// postBatched adds the request to the batch uploaded by flushBatch.
+func (a *App) postBatched(u string, body []byte) {
+	a.batch.add(&postRequest{url: u, body: body})
+}
+
+// sendOrdered sends req after the requests waiting in the retry queue. It is used when the
+// order matters, e.g. clearing alarms must not be overtaken by a replayed alarm.
+func (a *App) sendOrdered(req *postRequest) {
+	if a.sendQueue.Len() == 0 {
+		a.batch.add(req)
+		return
+	}
+	if err := a.sendQueue.Push(req.encode()); err != nil {
+		logrus.Errorf("error queueing %s %s: %s", req.httpMethod(), req.url, err)
+	}
+}
+
+// batchUnsupported returns true if the server answered 404 for the batch endpoint within batchReprobeInterval.
+func (a *App) batchUnsupported() bool {
+	return time.Now().UnixNano() < a.batchUnsupportedUntil.Load()
+}
+
+// flushBatch uploads the collected requests. They are queued for retry if the upload fails.
+func (a *App) flushBatch() {
+	reqs := a.batch.take()
+	if len(reqs) == 0 {
+		return
+	}
+	if !a.batchUnsupported() {
+		code, err := a.sendBatch(reqs, false)
+		if code == http.StatusOK {
+			return
+		}
+		if code != http.StatusNotFound {
+			logrus.Warnf("error %s: %d adding %d requests to retry queue: %v", batchURL, code, len(reqs), err)
+			for _, req := range reqs {
+				if err := a.sendQueue.Push(req.encode()); err != nil {
+					logrus.Errorf("error queueing %s: %s", req.url, err)
+				}
+			}
+			return
+		}
+	}
+	for _, req := range reqs {
+		if err := a.sendWithRetry(req); err != nil {
+			logrus.Errorf("error %s %s: %s", req.httpMethod(), req.url, err)
+		}
+	}
+}
+
+// sendBatch posts reqs gzip compressed in one request. Servers without the batch endpoint
+// answer 404 after which requests are sent one by one until batchReprobeInterval has passed.
+func (a *App) sendBatch(reqs []*postRequest, disableXFetch bool) (int, error) {
+	items := make([]batchItem, len(reqs))
+	for i, req := range reqs {
+		items[i] = batchItem{Method: req.method, URL: req.url, Body: req.body}
+	}
+	body, err := json.Marshal(batchRequest{Items: items})
+	if err != nil {
+		return 0, err
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(body); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Encoding", "gzip")
+	code, err := a.do(batchURL, http.MethodPost, nil, buf, header, disableXFetch)
+	if code == http.StatusNotFound {
+		if !a.batchUnsupported() {
+			logrus.Infof("%s not supported by server. sending requests one by one for %s", batchURL, batchReprobeInterval)
+		}
+		a.batchUnsupportedUntil.Store(time.Now().Add(batchReprobeInterval).UnixNano())
+	}
+	return code, err
+}
+
+// rejected returns true for client errors which will not succeed if the same batch is sent again.
+// Authentication and rate limiting can recover and 404 means batches are not supported.
+func rejected(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= 400 && code < 500
+}
+
+// takeBatch returns at most limit requests at the start of the queue which fit in one batch and
+// how many queued items they correspond to. Invalid items are skipped but counted.
+func (a *App) takeBatch(limit int) ([]*postRequest, int) {
+	var reqs []*postRequest
+	size := 0
+	items := a.sendQueue.PeekN(limit)
+	for i, item := range items {
+		size += len(item)
+		if i > 0 && size > maxBatchSize {
+			return reqs, i
+		}
+		req, err := decodePostRequest(item)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, len(items)
+}
@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/nergy-se/controller/pkg/modbusclient"
+	"github.com/sirupsen/logrus"
+)
+
+// Version is bumped when the file format changes.
+const Version = 1
+
+type Backup struct {
+	Version    int                   `json:"version"`
+	Controller types.HeatControlType `json:"controller"`
+	Time       time.Time             `json:"time"`
+	Registers  []Register            `json:"registers"`
+
+	// Restored is when the backup was written back to the pump. Control is suspended while set
+	// so reconcile does not undo the restore.
+	Restored *time.Time `json:"restored,omitempty"`
+
+	// Uploaded is set when the backup has been uploaded to cloud or added to the retry queue.
+	Uploaded bool `json:"uploaded,omitempty"`
+}
+
+type Register struct {
+	Name    string                  `json:"name"`
+	Type    controller.RegisterType `json:"type"`
+	Address uint16                  `json:"address"`
+	Data    []uint16                `json:"data"`  // raw register words or 0/1 for coils. This is what we restore
+	Value   float64                 `json:"value"` // scaled value for humans
+}
+
+// Backupable returns true if the register is a setting we can write back.
+func Backupable(r controller.Register) bool {
+	return r.Writable && (r.Type == controller.RegisterTypeHolding || r.Type == controller.RegisterTypeCoil)
+}
+
+// Create reads all writable holding registers and coils.
+func Create(c modbus.Client, controllerType types.HeatControlType, registers []controller.Register) (*Backup, error) {
+	b := &Backup{
+		Version:    Version,
+		Controller: controllerType,
+		Time:       time.Now(),
+	}
+	for _, r := range registers {
+		if !Backupable(r) {
+			continue
+		}
+
+		raw, err := r.ReadRaw(c)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", r.Name, err)
+		}
+		reg := Register{
+			Name:    r.Name,
+			Type:    r.Type,
+			Address: r.Address,
+			Value:   r.Value(raw),
+		}
+		if r.Type == controller.RegisterTypeCoil {
+			reg.Data = []uint16{uint16(reg.Value)}
+		} else {
+			for i := 0; i+1 < len(raw); i += 2 {
+				reg.Data = append(reg.Data, binary.BigEndian.Uint16(raw[i:i+2]))
+			}
+		}
+		b.Registers = append(b.Registers, reg)
+	}
+	return b, nil
+}
+
+// Restore writes all registers in the backup back to the controller.
+func Restore(c modbus.Client, b *Backup) error {
+	if b.Version != Version {
+		return fmt.Errorf("unsupported backup version %d", b.Version)
+	}
+	for _, r := range b.Registers {
+		if len(r.Data) == 0 {
+			continue
+		}
+		logrus.Infof("restore %s %s %d: %v", r.Name, r.Type, r.Address, r.Data)
+		var err error
+		switch r.Type {
+		case controller.RegisterTypeCoil:
+			_, err = c.WriteSingleCoil(r.Address, modbusclient.CoilValue(r.Data[0] == 1))
+		case controller.RegisterTypeHolding:
+			if len(r.Data) == 1 {
+				_, err = c.WriteSingleRegister(r.Address, r.Data[0])
+				break
+			}
+			data := make([]byte, len(r.Data)*2)
+			for i, v := range r.Data {
+				binary.BigEndian.PutUint16(data[i*2:], v)
+			}
+			_, err = c.WriteMultipleRegisters(r.Address, uint16(len(r.Data)), data)
+		default:
+			err = fmt.Errorf("cannot restore register type %s", r.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("error restoring %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (b *Backup) Save(filename string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
+
+func Load(filename string) (*Backup, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{}
+	return b, json.Unmarshal(data, b)
+}
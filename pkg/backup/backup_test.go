@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/tbrandon/mbserver"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	registers := []controller.Register{
+		{Name: "hotWaterStartTemperature", Type: controller.RegisterTypeHolding, Address: 22, Scale: 100, Writable: true},
+		{Name: "energy", Type: controller.RegisterTypeHolding, Address: 30, Quantity: 2, Writable: true},
+		{Name: "allowHeating", Type: controller.RegisterTypeCoil, Address: 9, Writable: true},
+		{Name: "outdoor", Type: controller.RegisterTypeInput, Address: 13, Scale: 100},
+		{Name: "readonly", Type: controller.RegisterTypeHolding, Address: 40},
+	}
+
+	serv := mbserver.NewServer()
+	serv.HoldingRegisters[22] = 4500
+	serv.HoldingRegisters[30] = 0x0007
+	serv.HoldingRegisters[31] = 0xdad5
+	serv.Coils[9] = 1
+	err := serv.ListenTCP("127.0.0.1:1503")
+	assert.NoError(t, err)
+	defer serv.Close()
+
+	handler := modbus.NewTCPClientHandler("127.0.0.1:1503")
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	b, err := Create(client, types.HeatControlTypeThermiaGenesis, registers)
+	assert.NoError(t, err)
+	assert.Len(t, b.Registers, 3)
+	assert.Equal(t, 45.0, b.Registers[0].Value)
+	assert.Equal(t, []uint16{0x0007, 0xdad5}, b.Registers[1].Data)
+	assert.Equal(t, []uint16{1}, b.Registers[2].Data)
+
+	filename := filepath.Join(t.TempDir(), "backup.json")
+	err = b.Save(filename)
+	assert.NoError(t, err)
+	b, err = Load(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, Version, b.Version)
+	assert.Equal(t, types.HeatControlTypeThermiaGenesis, b.Controller)
+
+	serv.HoldingRegisters[22] = 5000
+	serv.HoldingRegisters[30] = 0
+	serv.HoldingRegisters[31] = 0
+	serv.Coils[9] = 0
+
+	err = Restore(client, b)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(4500), serv.HoldingRegisters[22])
+	assert.Equal(t, uint16(0x0007), serv.HoldingRegisters[30])
+	assert.Equal(t, uint16(0xdad5), serv.HoldingRegisters[31])
+	assert.Equal(t, uint8(1), serv.Coils[9])
+}
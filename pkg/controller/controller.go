@@ -21,6 +21,12 @@ type Controller interface {
 	Alarms() ([]string, error)
 }
 
+// Overridable is implemented by controllers which can tell if they follow the Heating, Hotwater and
+// HotwaterForce flags of the hour config. Local overrides only change those flags.
+type Overridable interface {
+	SupportsOverrides() bool
+}
+
 func Scale100itof(i int, err error) (*float64, error) {
 	f := float64(i) / 100.0
 	return &f, err
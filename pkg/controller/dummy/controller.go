@@ -98,6 +98,10 @@ func (ts *Dummy) State() (*state.State, error) {
 	return s, nil
 }
 
+func (ts *Dummy) SupportsOverrides() bool {
+	return true
+}
+
 func (ts *Dummy) Reconcile(current *config.HourConfig) error {
 	err := ts.allowHeating(current.Heating)
 	if err != nil {
@@ -59,22 +59,22 @@ func (ts *Hogforsgst) State() (*state.State, error) {
 	s := &state.State{}
 	var err error
 
-	s.BrineIn, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(551))
+	s.BrineIn, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingBrineIn))
 	if err != nil {
 		return s, err
 	}
 
-	s.BrineOut, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(553))
+	s.BrineOut, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingBrineOut))
 	if err != nil {
 		return s, err
 	}
 
-	s.HeatCarrierForward, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(555))
+	s.HeatCarrierForward, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingHeatCarrierForward))
 	if err != nil {
 		return s, err
 	}
 
-	s.PumpBrine, err = controller.Scale1itof(ts.client.ReadHoldingRegister16(563))
+	s.PumpBrine, err = controller.Scale1itof(ts.client.ReadHoldingRegister16(holdingPumpBrine))
 	if err != nil {
 		return s, err
 	}
@@ -85,21 +85,21 @@ func (ts *Hogforsgst) State() (*state.State, error) {
 	// hetgas tillförd energi kw 971 1 dec
 	// ex (61.9+0.9) / 20.4kw
 
-	s.RadiatorForward, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(283)) // 101TE41.2 Värme framledningstemperatur
+	s.RadiatorForward, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingRadiatorForward)) // 101TE41.2 Värme framledningstemperatur
 	if err != nil {
 		return s, err
 	}
 
-	s.RadiatorReturn, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(281)) // 101TE42 Värme returtemperatur
+	s.RadiatorReturn, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingRadiatorReturn)) // 101TE42 Värme returtemperatur
 	if err != nil {
 		return s, err
 	}
 
-	s.Outdoor, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(275)) // 101TE00 Utetemperatur
+	s.Outdoor, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingOutdoor)) // 101TE00 Utetemperatur
 	if err != nil {
 		return s, err
 	}
-	gear, err := controller.Scale10itof(ts.client.ReadHoldingRegister16(565))
+	gear, err := controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingCompressorGear))
 	if err != nil {
 		return s, err
 	}
@@ -110,7 +110,7 @@ func (ts *Hogforsgst) State() (*state.State, error) {
 	speed := (float64(*gear) / 10.0) * 100 // it has 10 gears
 	s.Compressor = &speed
 
-	s.COP, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(408))
+	s.COP, err = controller.Scale10itof(ts.client.ReadHoldingRegister16(holdingCop))
 	if err != nil {
 		return nil, err
 	}
@@ -139,48 +139,49 @@ func (ts *Hogforsgst) MeterData() ([]*meter.Data, error) {
 		Model: "hogforsgst_heat_hgw",
 		Id:    "1002",
 	}
-	v, err := ts.client.ReadHoldingRegister32(1935) // kw
+	v, err := ts.client.ReadHoldingRegister32(holdingElectricPower) // kw
 	if err != nil {
 		return nil, err
 	}
 	meterElectricity.Current_W = (float64(v) / 10.0) * 1000
+	meterElectricity.Import_W = meterElectricity.Current_W // the heat pump only consumes
 
-	v, err = ts.client.ReadHoldingRegister32(1933) // kWh
+	v, err = ts.client.ReadHoldingRegister32(holdingElectricEnergy) // kWh
 	if err != nil {
 		return nil, err
 	}
 	if v == 0.0 {
-		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(1933)")
+		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(%d)", holdingElectricEnergy)
 	}
 	meterElectricity.Total_WH = (float64(v) / 10.0) * 1000
 
-	v, err = ts.client.ReadHoldingRegister32(974) // kw
+	v, err = ts.client.ReadHoldingRegister32(holdingHeatPower) // kw
 	if err != nil {
 		return nil, err
 	}
 	meterHeat.Current_W = (float64(v) / 10.0) * 1000
 
-	v, err = ts.client.ReadHoldingRegister32(1603) // MWh
+	v, err = ts.client.ReadHoldingRegister32(holdingHeatEnergy) // MWh
 	if err != nil {
 		return nil, err
 	}
 	if v == 0.0 {
-		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(1603)")
+		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(%d)", holdingHeatEnergy)
 	}
 	meterHeat.Total_WH = (float64(v) / 100.0) * 1000000
 
-	v, err = ts.client.ReadHoldingRegister32(970) // kw
+	v, err = ts.client.ReadHoldingRegister32(holdingHeatHGWPower) // kw
 	if err != nil {
 		return nil, err
 	}
 	meterHeatHGW.Current_W = (float64(v) / 10.0) * 1000
 
-	v, err = ts.client.ReadHoldingRegister32(972) // MWh
+	v, err = ts.client.ReadHoldingRegister32(holdingHeatHGWEnergy) // MWh
 	if err != nil {
 		return nil, err
 	}
 	if v == 0.0 {
-		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(972)")
+		return nil, fmt.Errorf("got zero value from ReadHoldingRegister32(%d)", holdingHeatHGWEnergy)
 	}
 	meterHeatHGW.Total_WH = (float64(v) / 100.0) * 1000000
 
@@ -205,16 +206,21 @@ func (ts *Hogforsgst) allowHeatpump(price float64) bool {
 	return allow
 }
 
+// SupportsOverrides is false since the heat pump is only allowed based on price.
+func (ts *Hogforsgst) SupportsOverrides() bool {
+	return false
+}
+
 func (ts *Hogforsgst) Reconcile(current *config.HourConfig) error {
 
 	if !ts.allowHeatpump(current.Price) {
 		ts.heatingAllowed = false
 		ts.hotwaterAllowed = false
-		_, err := ts.client.WriteSingleRegister(4031-1, 1) // external control true
+		_, err := ts.client.WriteSingleRegister(holdingExternalControl, 1) // external control true
 		if err != nil {
 			return err
 		}
-		_, err = ts.client.WriteSingleRegister(4051-1, 20) // 20 C will turn off heatpump
+		_, err = ts.client.WriteSingleRegister(holdingExternalControlSetpoint, 20) // 20 C will turn off heatpump
 		if err != nil {
 			return err
 		}
@@ -223,7 +229,7 @@ func (ts *Hogforsgst) Reconcile(current *config.HourConfig) error {
 	ts.heatingAllowed = true
 	ts.hotwaterAllowed = true
 	// allow heatpump normal operations.
-	_, err := ts.client.WriteSingleRegister(4031-1, 0) // external control false
+	_, err := ts.client.WriteSingleRegister(holdingExternalControl, 0) // external control false
 	if err != nil {
 		return err
 	}
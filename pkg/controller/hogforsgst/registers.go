@@ -0,0 +1,47 @@
+package hogforsgst
+
+import "github.com/nergy-se/controller/pkg/controller"
+
+// Addresses used by the controller and in Registers.
+const (
+	holdingOutdoor                 = 275
+	holdingRadiatorReturn          = 281
+	holdingRadiatorForward         = 283
+	holdingCop                     = 408
+	holdingBrineIn                 = 551
+	holdingBrineOut                = 553
+	holdingHeatCarrierForward      = 555
+	holdingPumpBrine               = 563
+	holdingCompressorGear          = 565
+	holdingHeatHGWPower            = 970
+	holdingHeatHGWEnergy           = 972
+	holdingHeatPower               = 974
+	holdingHeatEnergy              = 1603
+	holdingElectricEnergy          = 1933
+	holdingElectricPower           = 1935
+	holdingExternalControl         = 4031 - 1
+	holdingExternalControlSetpoint = 4051 - 1
+)
+
+// Registers known on hogfors GST. Names follow the json names in state.State where possible.
+var Registers = []controller.Register{
+	{Name: "outdoor", Type: controller.RegisterTypeHolding, Address: holdingOutdoor, Scale: 10, Unit: "°C", Description: "101TE00 Utetemperatur"},
+	{Name: "radiatorReturn", Type: controller.RegisterTypeHolding, Address: holdingRadiatorReturn, Scale: 10, Unit: "°C", Description: "101TE42 Värme returtemperatur"},
+	{Name: "radiatorForward", Type: controller.RegisterTypeHolding, Address: holdingRadiatorForward, Scale: 10, Unit: "°C", Description: "101TE41.2 Värme framledningstemperatur"},
+	{Name: "cop", Type: controller.RegisterTypeHolding, Address: holdingCop, Scale: 10},
+	{Name: "brineIn", Type: controller.RegisterTypeHolding, Address: holdingBrineIn, Scale: 10, Unit: "°C"},
+	{Name: "brineOut", Type: controller.RegisterTypeHolding, Address: holdingBrineOut, Scale: 10, Unit: "°C"},
+	{Name: "heatCarrierForward", Type: controller.RegisterTypeHolding, Address: holdingHeatCarrierForward, Scale: 10, Unit: "°C"},
+	{Name: "pumpBrine", Type: controller.RegisterTypeHolding, Address: holdingPumpBrine, Unit: "%"},
+	{Name: "compressorGear", Type: controller.RegisterTypeHolding, Address: holdingCompressorGear, Scale: 10, Description: "Compressor gear 0-10"},
+
+	{Name: "heatHGWPower", Type: controller.RegisterTypeHolding, Address: holdingHeatHGWPower, Quantity: 2, Scale: 10, Unit: "kW", Description: "Hot gas heat power"},
+	{Name: "heatHGWEnergy", Type: controller.RegisterTypeHolding, Address: holdingHeatHGWEnergy, Quantity: 2, Scale: 100, Unit: "MWh", Description: "Hot gas heat energy"},
+	{Name: "heatPower", Type: controller.RegisterTypeHolding, Address: holdingHeatPower, Quantity: 2, Scale: 10, Unit: "kW"},
+	{Name: "heatEnergy", Type: controller.RegisterTypeHolding, Address: holdingHeatEnergy, Quantity: 2, Scale: 100, Unit: "MWh"},
+	{Name: "electricEnergy", Type: controller.RegisterTypeHolding, Address: holdingElectricEnergy, Quantity: 2, Scale: 10, Unit: "kWh"},
+	{Name: "electricPower", Type: controller.RegisterTypeHolding, Address: holdingElectricPower, Quantity: 2, Scale: 10, Unit: "kW"},
+
+	{Name: "externalControl", Type: controller.RegisterTypeHolding, Address: holdingExternalControl, Writable: true, Description: "1 enables external control"},
+	{Name: "externalControlSetpoint", Type: controller.RegisterTypeHolding, Address: holdingExternalControlSetpoint, Unit: "°C", Writable: true, Description: "20 C will turn off heatpump when external control is enabled"},
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goburrow/modbus"
+	"github.com/nergy-se/controller/pkg/modbusclient"
+)
+
+type RegisterType string
+
+const (
+	RegisterTypeInput         RegisterType = "inputreg"
+	RegisterTypeHolding       RegisterType = "holdingreg"
+	RegisterTypeCoil          RegisterType = "coil"
+	RegisterTypeDiscreteInput RegisterType = "discreteinputreg"
+)
+
+// Register describes a modbus address known by a controller.
+type Register struct {
+	Name        string
+	Type        RegisterType
+	Address     uint16
+	Quantity    uint16  // number of 16 bit registers to read. 0 means 1
+	Scale       float64 // raw value is divided by scale. 0 means 1
+	Unit        string
+	Writable    bool
+	Description string
+}
+
+func (r Register) quantity() uint16 {
+	if r.Quantity == 0 {
+		return 1
+	}
+	return r.Quantity
+}
+
+// Value decodes raw modbus response data into a scaled value.
+func (r Register) Value(raw []byte) float64 {
+	if r.Type == RegisterTypeCoil || r.Type == RegisterTypeDiscreteInput {
+		if len(raw) > 0 && raw[0]&1 == 1 {
+			return 1
+		}
+		return 0
+	}
+
+	v := float64(modbusclient.Decode(raw))
+	if r.Scale != 0 {
+		v /= r.Scale
+	}
+	return v
+}
+
+// ReadRaw reads the register and returns the raw response data.
+func (r Register) ReadRaw(c modbus.Client) ([]byte, error) {
+	switch r.Type {
+	case RegisterTypeInput:
+		return c.ReadInputRegisters(r.Address, r.quantity())
+	case RegisterTypeHolding:
+		return c.ReadHoldingRegisters(r.Address, r.quantity())
+	case RegisterTypeCoil:
+		return c.ReadCoils(r.Address, 1)
+	case RegisterTypeDiscreteInput:
+		return c.ReadDiscreteInputs(r.Address, 1)
+	}
+	return nil, fmt.Errorf("unknown register type %s", r.Type)
+}
+
+// Read reads the register and returns the scaled value.
+func (r Register) Read(c modbus.Client) (float64, error) {
+	b, err := r.ReadRaw(c)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s %d: %w", r.Type, r.Address, err)
+	}
+	return r.Value(b), nil
+}
+
+// String formats value with the register unit.
+func (r Register) String(value float64) string {
+	if r.Type == RegisterTypeCoil || r.Type == RegisterTypeDiscreteInput {
+		return fmt.Sprintf("%t", value == 1)
+	}
+	s := fmt.Sprintf("%.2f", value)
+	if r.Unit != "" {
+		s += " " + r.Unit
+	}
+	return s
+}
+
+func FindRegister(registers []Register, name string) (Register, bool) {
+	for _, r := range registers {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return Register{}, false
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterValue(t *testing.T) {
+	r := Register{Name: "outdoor", Type: RegisterTypeInput, Address: 13, Scale: 100, Unit: "°C"}
+	assert.Equal(t, -15.5, r.Value([]byte{0xf9, 0xf2}))
+	assert.Equal(t, "-15.50 °C", r.String(-15.5))
+
+	r = Register{Name: "electricEnergy", Type: RegisterTypeHolding, Quantity: 2, Scale: 10}
+	assert.Equal(t, 51477.3, r.Value([]byte{0x00, 0x07, 0xda, 0xd5}))
+
+	r = Register{Name: "allowHeating", Type: RegisterTypeCoil}
+	assert.Equal(t, 1.0, r.Value([]byte{0x01}))
+	assert.Equal(t, "true", r.String(1))
+}
+
+func TestFindRegister(t *testing.T) {
+	regs := []Register{{Name: "outdoor"}, {Name: "brineIn"}}
+	r, ok := FindRegister(regs, "brinein")
+	assert.True(t, ok)
+	assert.Equal(t, "brineIn", r.Name)
+
+	_, ok = FindRegister(regs, "cop")
+	assert.False(t, ok)
+}
@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"github.com/nergy-se/controller/pkg/api/v1/types"
+	"github.com/nergy-se/controller/pkg/controller"
+	"github.com/nergy-se/controller/pkg/controller/hogforsgst"
+	"github.com/nergy-se/controller/pkg/controller/thermiagenesis"
+)
+
+var registers = map[types.HeatControlType][]controller.Register{
+	types.HeatControlTypeThermiaGenesis: thermiagenesis.Registers,
+	types.HeatControlTypeHogforsGST:     hogforsgst.Registers,
+}
+
+// slaveIDs must match what app.setupController uses.
+var slaveIDs = map[types.HeatControlType]byte{
+	types.HeatControlTypeHogforsGST: 1,
+}
+
+// Registers returns all known registers for controller type t. Returns nil if none are known.
+func Registers(t types.HeatControlType) []controller.Register {
+	return registers[t]
+}
+
+func SlaveID(t types.HeatControlType) byte {
+	return slaveIDs[t]
+}
+
+// Types returns all controller types that have known registers.
+func Types() []types.HeatControlType {
+	result := make([]types.HeatControlType, 0, len(registers))
+	for t := range registers {
+		result = append(result, t)
+	}
+	return result
+}
@@ -51,82 +51,82 @@ func (ts *Thermiagenesis) State() (*state.State, error) {
 	}
 	var err error
 
-	s.BrineIn, err = controller.Scale100itof(ts.client.ReadInputRegister(10)) // 10 brine in scale 100
+	s.BrineIn, err = controller.Scale100itof(ts.client.ReadInputRegister(inputBrineIn)) // 10 brine in scale 100
 	if err != nil {
 		return s, err
 	}
 
-	s.BrineOut, err = controller.Scale100itof(ts.client.ReadInputRegister(11)) // 11 brine out scale 100
+	s.BrineOut, err = controller.Scale100itof(ts.client.ReadInputRegister(inputBrineOut)) // 11 brine out scale 100
 	if err != nil {
 		return s, err
 	}
-	s.Outdoor, err = controller.Scale100itof(ts.client.ReadInputRegister(13)) // 13 Outdoor temp scale 100
+	s.Outdoor, err = controller.Scale100itof(ts.client.ReadInputRegister(inputOutdoor)) // 13 Outdoor temp scale 100
 	if err != nil {
 		return s, err
 	}
-	s.Indoor, err = controller.Scale10itof(ts.client.ReadInputRegister(121)) // Room temperature sensor scale 10
+	s.Indoor, err = controller.Scale10itof(ts.client.ReadInputRegister(inputIndoor)) // Room temperature sensor scale 10
 	if err != nil {
 		return s, err
 	}
-	s.IndoorSetpoint, err = controller.Scale100itof(ts.client.ReadHoldingRegister16(5)) // Room temperature setpoint sensor scale 100
+	s.IndoorSetpoint, err = controller.Scale100itof(ts.client.ReadHoldingRegister16(holdingIndoorSetpoint)) // Room temperature setpoint sensor scale 100
 	if err != nil {
 		return s, err
 	}
 
-	s.WarmWater, err = controller.Scale100itof(ts.client.ReadInputRegister(17)) // 17 tank Tap water weighted temperature scale 100
+	s.WarmWater, err = controller.Scale100itof(ts.client.ReadInputRegister(inputWarmWater)) // 17 tank Tap water weighted temperature scale 100
 	if err != nil {
 		return s, err
 	}
-	s.Compressor, err = controller.Scale100itof(ts.client.ReadInputRegister(54)) // Compressor speed percent scale 100
+	s.Compressor, err = controller.Scale100itof(ts.client.ReadInputRegister(inputCompressor)) // Compressor speed percent scale 100
 	if err != nil {
 		return s, err
 	}
 
-	s.RadiatorForward, err = controller.Scale100itof(ts.client.ReadInputRegister(12)) // System supply line temperature scale 100 visar bara 200.0 om inte inkopplad.
+	s.RadiatorForward, err = controller.Scale100itof(ts.client.ReadInputRegister(inputRadiatorForward)) // System supply line temperature scale 100 visar bara 200.0 om inte inkopplad.
 	// https://github.com/CJNE/thermiagenesis/issues/157#issuecomment-1250896092
 	if err != nil {
 		return s, err
 	}
-	s.RadiatorReturn, err = controller.Scale100itof(ts.client.ReadInputRegister(27)) // input reg 27 System return line temperature. visar 0 hos per
+	s.RadiatorReturn, err = controller.Scale100itof(ts.client.ReadInputRegister(inputRadiatorReturn)) // input reg 27 System return line temperature. visar 0 hos per
 	if err != nil {
 		return s, err
 	}
 
-	s.HeatCarrierForward, err = controller.Scale100itof(ts.client.ReadInputRegister(9)) // input reg 9 Condenser out temperature
+	s.HeatCarrierForward, err = controller.Scale100itof(ts.client.ReadInputRegister(inputHeatCarrierForward)) // input reg 9 Condenser out temperature
 	if err != nil {
 		return s, err
 	}
 	ts.heatCarrierForward = *s.HeatCarrierForward
-	s.HeatCarrierReturn, err = controller.Scale100itof(ts.client.ReadInputRegister(8)) // input reg 8 Condenser in
+	s.HeatCarrierReturn, err = controller.Scale100itof(ts.client.ReadInputRegister(inputHeatCarrierReturn)) // input reg 8 Condenser in
 	if err != nil {
 		return s, err
 	}
-	s.PumpBrine, err = controller.Scale100itof(ts.client.ReadInputRegister(44)) // input reg 44 Brine circulation pump speed (%) just nu 66.81 PumpBrine
+	s.PumpBrine, err = controller.Scale100itof(ts.client.ReadInputRegister(inputPumpBrine)) // input reg 44 Brine circulation pump speed (%) just nu 66.81 PumpBrine
 	if err != nil {
 		return s, err
 	}
-	s.PumpHeat, err = controller.Scale100itof(ts.client.ReadInputRegister(39)) // input reg 39 Condenser circulation pump speed (%) just nu 60.1 PumpHeat
+	s.PumpHeat, err = controller.Scale100itof(ts.client.ReadInputRegister(inputPumpHeat)) // input reg 39 Condenser circulation pump speed (%) just nu 60.1 PumpHeat
 	if err != nil {
 		return s, err
 	}
 
-	s.HotGasCompressor, err = controller.Scale100itof(ts.client.ReadInputRegister(7)) // input reg 7 Discharge pipe temperature
+	s.HotGasCompressor, err = controller.Scale100itof(ts.client.ReadInputRegister(inputHotGasCompressor)) // input reg 7 Discharge pipe temperature
 	if err != nil {
 		return s, err
 	}
-	s.SuperHeatTemperature, err = controller.Scale100itof(ts.client.ReadInputRegister(125)) // input reg 125 Superheat temperature
+	s.SuperHeatTemperature, err = controller.Scale100itof(ts.client.ReadInputRegister(inputSuperHeatTemperature)) // input reg 125 Superheat temperature
 	if err != nil {
 		return s, err
 	}
-	s.SuctionGasTemperature, err = controller.Scale100itof(ts.client.ReadInputRegister(130)) // input reg 130 Suction gas temperature
+	s.SuctionGasTemperature, err = controller.Scale100itof(ts.client.ReadInputRegister(inputSuctionGasTemperature)) // input reg 130 Suction gas temperature
 	if err != nil {
 		return s, err
 	}
-	s.LowPressureSidePressure, err = controller.Scale100itof(ts.client.ReadInputRegister(127)) // input reg 127 Low pressure side, pressure (bar(g))
+	s.LowPressureSidePressure, err = controller.Scale100itof(ts.client.ReadInputRegister(inputLowPressureSidePressure)) // input reg 127 Low pressure side, pressure (bar(g))
 	if err != nil {
 		return s, err
 	}
-	s.HighPressureSidePressure, err = controller.Scale100itof(ts.client.ReadInputRegister(128)) // input reg 128 High pressure side, pressure (bar(g))
+	s.HighPressureSidePressure, err = controller.Scale100itof(ts.client.ReadInputRegister(inputHighPressureSidePressure)) // input reg 128 High pressure side, pressure (bar(g))
 	if err != nil {
 		return s, err
 	}
@@ -174,6 +174,11 @@ func (ts *Thermiagenesis) allowHeatpump(price float64) bool {
 	return allow
 }
 
+// SupportsOverrides is false when controlling based on DistrictHeatingPrice since only the price is used then.
+func (ts *Thermiagenesis) SupportsOverrides() bool {
+	return ts.cloudConfig.DistrictHeatingPrice == 0.0
+}
+
 func (ts *Thermiagenesis) Reconcile(current *config.HourConfig) error {
 
 	if ts.cloudConfig.DistrictHeatingPrice == 0.0 { // control based on levels.
@@ -207,12 +212,12 @@ func (ts *Thermiagenesis) Reconcile(current *config.HourConfig) error {
 }
 
 func (ts *Thermiagenesis) allowHeating(b bool) error {
-	_, err := ts.client.WriteSingleCoil(9, modbusclient.CoilValue(b))
+	_, err := ts.client.WriteSingleCoil(coilAllowHeating, modbusclient.CoilValue(b))
 	return err
 }
 
 func (ts *Thermiagenesis) allowHotwater(b bool) error {
-	_, err := ts.client.WriteSingleCoil(8, modbusclient.CoilValue(b))
+	_, err := ts.client.WriteSingleCoil(coilAllowHotwater, modbusclient.CoilValue(b))
 	return err
 }
 
@@ -229,14 +234,14 @@ func (ts *Thermiagenesis) boostHotwater(b bool) error {
 	}
 
 	logrus.WithFields(logrus.Fields{"start": start, "stop": stop}).Debugf("thermiagenesis: boosthotwater")
-	_, err := ts.client.WriteSingleRegister(22, uint16(start*100)) // 100 = 1c
+	_, err := ts.client.WriteSingleRegister(holdingHotWaterStartTemperature, uint16(start*100)) // 100 = 1c
 	if err != nil {
-		return fmt.Errorf("error writeTemps 22: %w", err)
+		return fmt.Errorf("error writeTemps %d: %w", holdingHotWaterStartTemperature, err)
 	}
 
-	_, err = ts.client.WriteSingleRegister(23, uint16(stop*100))
+	_, err = ts.client.WriteSingleRegister(holdingHotWaterStopTemperature, uint16(stop*100))
 	if err != nil {
-		return fmt.Errorf("error writeTemps 23: %w", err)
+		return fmt.Errorf("error writeTemps %d: %w", holdingHotWaterStopTemperature, err)
 	}
 	return nil
 
@@ -246,11 +251,11 @@ func (ts *Thermiagenesis) SetHeatCurve(curve []float64, adjust float64) error {
 	if len(curve) != 7 {
 		return fmt.Errorf("expected 7 curves got: %d", len(curve))
 	}
-	var address uint16 = 5
-	// var address uint16 = 6
+	// holdingIndoorSetpoint is followed by holdingHeatCurve1-7
+	var address uint16 = holdingIndoorSetpoint
 	for _, temp := range append([]float64{adjust + 20.0}, curve...) { // thermia adjust is offset +20
 		var t uint16
-		if address > 5 {
+		if address > holdingIndoorSetpoint {
 			t = uint16((temp + adjust) * 100)
 
 		} else {
@@ -276,7 +281,7 @@ func (ts *Thermiagenesis) GetHeatCurve() ([]float64, float64, error) {
 	// 11 Set point heat curve, Y-coordinate 6
 	// 12 Set point heat curve, Y-coordinate 7 (lowest outdoor temperature)
 
-	data, err := ts.client.ReadHoldingRegisterRaw(5, 8)
+	data, err := ts.client.ReadHoldingRegisterRaw(holdingIndoorSetpoint, 8) // followed by holdingHeatCurve1-7
 	if err != nil {
 		return nil, 0, err
 	}
@@ -286,7 +291,7 @@ func (ts *Thermiagenesis) GetHeatCurve() ([]float64, float64, error) {
 }
 
 func (ts *Thermiagenesis) GetHeatingSeasonStopTemperature() (float64, error) {
-	temp, err := ts.client.ReadHoldingRegister16(16) // heatingSeasonStopTemperature
+	temp, err := ts.client.ReadHoldingRegister16(holdingHeatingSeasonStopTemperature)
 	if err != nil {
 		return 0, err
 	}
@@ -294,7 +299,7 @@ func (ts *Thermiagenesis) GetHeatingSeasonStopTemperature() (float64, error) {
 }
 func (ts *Thermiagenesis) SetHeatingSeasonStopTemperature(t float64) error {
 	logrus.Info("SetHeatingSeasonStopTemperature", t)
-	_, err := ts.client.WriteSingleRegister(16, uint16(t*100))
+	_, err := ts.client.WriteSingleRegister(holdingHeatingSeasonStopTemperature, uint16(t*100))
 	return err
 }
 
@@ -0,0 +1,87 @@
+package thermiagenesis
+
+import "github.com/nergy-se/controller/pkg/controller"
+
+// Addresses used by the controller and in Registers.
+const (
+	holdingOperationalMode              = 0
+	holdingIndoorSetpoint               = 5
+	holdingHeatCurve1                   = 6
+	holdingHeatCurve2                   = 7
+	holdingHeatCurve3                   = 8
+	holdingHeatCurve4                   = 9
+	holdingHeatCurve5                   = 10
+	holdingHeatCurve6                   = 11
+	holdingHeatCurve7                   = 12
+	holdingHeatingSeasonStopTemperature = 16
+	holdingHotWaterStartTemperature     = 22
+	holdingHotWaterStopTemperature      = 23
+
+	coilAllowHotwater = 8
+	coilAllowHeating  = 9
+
+	inputCurrentDemand            = 1
+	inputAvailableGears           = 4
+	inputHotGasCompressor         = 7
+	inputHeatCarrierReturn        = 8
+	inputHeatCarrierForward       = 9
+	inputBrineIn                  = 10
+	inputBrineOut                 = 11
+	inputRadiatorForward          = 12
+	inputOutdoor                  = 13
+	inputWarmWater                = 17
+	inputSupplyLineSetpoint       = 18
+	inputRadiatorReturn           = 27
+	inputPumpHeat                 = 39
+	inputPumpBrine                = 44
+	inputCompressor               = 54
+	inputCurrentGear              = 61
+	inputIndoor                   = 121
+	inputSuperHeatTemperature     = 125
+	inputLowPressureSidePressure  = 127
+	inputHighPressureSidePressure = 128
+	inputSuctionGasTemperature    = 130
+	inputMixValve1Setpoint        = 147
+)
+
+// Registers known on thermia genesis. Names follow the json names in state.State where possible.
+var Registers = []controller.Register{
+	{Name: "operationalMode", Type: controller.RegisterTypeHolding, Address: holdingOperationalMode, Writable: true, Description: "1: OFF, 2: Standby, 3: ON/Auto"},
+	{Name: "indoorSetpoint", Type: controller.RegisterTypeHolding, Address: holdingIndoorSetpoint, Scale: 100, Unit: "°C", Writable: true, Description: "Comfort wheel setting"},
+	{Name: "heatCurve1", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve1, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 1 (highest outdoor temperature)"},
+	{Name: "heatCurve2", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve2, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 2"},
+	{Name: "heatCurve3", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve3, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 3"},
+	{Name: "heatCurve4", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve4, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 4"},
+	{Name: "heatCurve5", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve5, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 5"},
+	{Name: "heatCurve6", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve6, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 6"},
+	{Name: "heatCurve7", Type: controller.RegisterTypeHolding, Address: holdingHeatCurve7, Scale: 100, Unit: "°C", Writable: true, Description: "Set point heat curve, Y-coordinate 7 (lowest outdoor temperature)"},
+	{Name: "heatingSeasonStopTemperature", Type: controller.RegisterTypeHolding, Address: holdingHeatingSeasonStopTemperature, Scale: 100, Unit: "°C", Writable: true},
+	{Name: "hotWaterStartTemperature", Type: controller.RegisterTypeHolding, Address: holdingHotWaterStartTemperature, Scale: 100, Unit: "°C", Writable: true},
+	{Name: "hotWaterStopTemperature", Type: controller.RegisterTypeHolding, Address: holdingHotWaterStopTemperature, Scale: 100, Unit: "°C", Writable: true},
+
+	{Name: "allowHotwater", Type: controller.RegisterTypeCoil, Address: coilAllowHotwater, Writable: true},
+	{Name: "allowHeating", Type: controller.RegisterTypeCoil, Address: coilAllowHeating, Writable: true},
+
+	{Name: "currentDemand", Type: controller.RegisterTypeInput, Address: inputCurrentDemand, Description: "1: Manual operation, 2: Defrost, 3: Hot water, 4: Heat, 5: Cool, 6: Pool, 7: Anti legionella, 98: Standby 99: No demand 100: OFF"},
+	{Name: "availableGears", Type: controller.RegisterTypeInput, Address: inputAvailableGears},
+	{Name: "hotGasCompressor", Type: controller.RegisterTypeInput, Address: inputHotGasCompressor, Scale: 100, Unit: "°C", Description: "Discharge pipe temperature"},
+	{Name: "heatCarrierReturn", Type: controller.RegisterTypeInput, Address: inputHeatCarrierReturn, Scale: 100, Unit: "°C", Description: "Condenser in temperature"},
+	{Name: "heatCarrierForward", Type: controller.RegisterTypeInput, Address: inputHeatCarrierForward, Scale: 100, Unit: "°C", Description: "Condenser out temperature"},
+	{Name: "brineIn", Type: controller.RegisterTypeInput, Address: inputBrineIn, Scale: 100, Unit: "°C"},
+	{Name: "brineOut", Type: controller.RegisterTypeInput, Address: inputBrineOut, Scale: 100, Unit: "°C"},
+	{Name: "radiatorForward", Type: controller.RegisterTypeInput, Address: inputRadiatorForward, Scale: 100, Unit: "°C", Description: "System supply line temperature. Shows 200.0 if not connected"},
+	{Name: "outdoor", Type: controller.RegisterTypeInput, Address: inputOutdoor, Scale: 100, Unit: "°C"},
+	{Name: "warmWater", Type: controller.RegisterTypeInput, Address: inputWarmWater, Scale: 100, Unit: "°C", Description: "Tank tap water weighted temperature"},
+	{Name: "supplyLineSetpoint", Type: controller.RegisterTypeInput, Address: inputSupplyLineSetpoint, Scale: 100, Unit: "°C", Description: "System supply line calculated set point"},
+	{Name: "radiatorReturn", Type: controller.RegisterTypeInput, Address: inputRadiatorReturn, Scale: 100, Unit: "°C", Description: "System return line temperature"},
+	{Name: "pumpHeat", Type: controller.RegisterTypeInput, Address: inputPumpHeat, Scale: 100, Unit: "%", Description: "Condenser circulation pump speed"},
+	{Name: "pumpBrine", Type: controller.RegisterTypeInput, Address: inputPumpBrine, Scale: 100, Unit: "%", Description: "Brine circulation pump speed"},
+	{Name: "compressor", Type: controller.RegisterTypeInput, Address: inputCompressor, Scale: 100, Unit: "%", Description: "Compressor speed"},
+	{Name: "currentGear", Type: controller.RegisterTypeInput, Address: inputCurrentGear},
+	{Name: "indoor", Type: controller.RegisterTypeInput, Address: inputIndoor, Scale: 10, Unit: "°C", Description: "Room temperature sensor"},
+	{Name: "superHeatTemperature", Type: controller.RegisterTypeInput, Address: inputSuperHeatTemperature, Scale: 100, Unit: "K"},
+	{Name: "lowPressureSidePressure", Type: controller.RegisterTypeInput, Address: inputLowPressureSidePressure, Scale: 100, Unit: "bar"},
+	{Name: "highPressureSidePressure", Type: controller.RegisterTypeInput, Address: inputHighPressureSidePressure, Scale: 100, Unit: "bar"},
+	{Name: "suctionGasTemperature", Type: controller.RegisterTypeInput, Address: inputSuctionGasTemperature, Scale: 100, Unit: "°C"},
+	{Name: "mixValve1Setpoint", Type: controller.RegisterTypeInput, Address: inputMixValve1Setpoint, Scale: 100, Unit: "°C", Description: "Desired temperature distribution circuit Mix valve 1"},
+}
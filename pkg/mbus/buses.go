@@ -0,0 +1,67 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Buses keeps one Mbus per device so several buses can be used at the same time.
+type Buses struct {
+	defaultDevice   string
+	defaultBaudRate int
+	buses           map[string]*Mbus
+	mutex           sync.Mutex
+}
+
+// NewBuses uses defaultDevice and defaultBaudRate for meters without them. Empty means DefaultDevice and DefaultBaudRate.
+func NewBuses(defaultDevice string, defaultBaudRate int) *Buses {
+	if defaultDevice == "" {
+		defaultDevice = DefaultDevice
+	}
+	if defaultBaudRate == 0 {
+		defaultBaudRate = DefaultBaudRate
+	}
+	return &Buses{
+		defaultDevice:   defaultDevice,
+		defaultBaudRate: defaultBaudRate,
+		buses:           make(map[string]*Mbus),
+	}
+}
+
+// Get returns the bus for device which is a serial device or a M-Bus/TCP gateway in host:port format.
+// Empty device or baudRate uses the defaults. A serial bus can only be used with one baud rate so
+// asking for another baud rate than the open bus uses is an error.
+func (b *Buses) Get(device string, baudRate int) (*Mbus, error) {
+	if device == "" {
+		device = b.defaultDevice
+	}
+	if baudRate == 0 {
+		baudRate = b.defaultBaudRate
+	}
+
+	device, _ = parseDevice(device)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if bus, ok := b.buses[device]; ok {
+		if !bus.tcp && bus.baudRate != baudRate {
+			return nil, fmt.Errorf("mbus %s is already used with baud rate %d not %d", device, bus.baudRate, baudRate)
+		}
+		return bus, nil
+	}
+	bus := New(device, baudRate)
+	b.buses[bus.device] = bus
+	return bus, nil
+}
+
+func (b *Buses) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var errs []error
+	for device, bus := range b.buses {
+		errs = append(errs, bus.Close())
+		delete(b.buses, device)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package mbus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBusesGet(t *testing.T) {
+	buses := NewBuses("", 0)
+
+	bus, err := buses.Get("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDevice, bus.device)
+	assert.Equal(t, DefaultBaudRate, bus.baudRate)
+	same, err := buses.Get("/dev/ttyAMA0", 2400)
+	assert.NoError(t, err)
+	assert.Same(t, bus, same)
+
+	_, err = buses.Get("/dev/ttyAMA0", 9600)
+	assert.EqualError(t, err, "mbus /dev/ttyAMA0 is already used with baud rate 2400 not 9600")
+
+	usb, err := buses.Get("/dev/ttyUSB0", 9600)
+	assert.NoError(t, err)
+	assert.NotSame(t, bus, usb)
+	assert.Equal(t, 9600, usb.baudRate)
+	assert.Len(t, buses.buses, 2)
+
+	assert.NoError(t, buses.Close())
+	assert.Len(t, buses.buses, 0)
+}
@@ -0,0 +1,261 @@
+package mbus
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jonaz/gombus"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+)
+
+// Quantity is what a data record measures, decoded from its VIF and VIFE.
+type Quantity string
+
+const (
+	QuantityEnergy               Quantity = "energy"               // Wh
+	QuantityExportEnergy         Quantity = "exportEnergy"         // Wh
+	QuantityPower                Quantity = "power"                // W
+	QuantityExportPower          Quantity = "exportPower"          // W
+	QuantityReactiveEnergy       Quantity = "reactiveEnergy"       // varh
+	QuantityReactiveExportEnergy Quantity = "reactiveExportEnergy" // varh
+	QuantityReactivePower        Quantity = "reactivePower"        // var
+	QuantityVoltage              Quantity = "voltage"              // V
+	QuantityCurrent              Quantity = "current"              // A
+	QuantityVolume               Quantity = "volume"               // m3
+	QuantityVolumeFlow           Quantity = "volumeFlow"           // m3/h
+	QuantityFlowTemperature      Quantity = "flowTemperature"      // C
+	QuantityReturnTemperature    Quantity = "returnTemperature"    // C
+	QuantityTempDifference       Quantity = "tempDifference"       // K
+)
+
+// Record is a current value in a normalized unit. Device is the DIFE subunit which many
+// electricity meters use for the phase where 0 is the total and 1-3 is L1-L3.
+type Record struct {
+	Quantity Quantity
+	Device   int
+	Value    float64
+}
+
+// Decode returns the current values of all records with a known quantity in the order
+// they appear in frame. Historic values, tariffs and min/max values are ignored.
+// The records are decoded here instead of by gombus since it does not keep the VIFE
+// which marks export and scales many electricity records.
+func Decode(frame gombus.LongFrame) ([]Record, error) {
+	if len(frame) < 21 || frame.CI() != 0x72 {
+		return nil, fmt.Errorf("mbus frame is not a variable data response: % x", frame)
+	}
+	drs, err := parseRecords(frame[19 : len(frame)-2])
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, dr := range drs {
+		if dr.function != 0 || dr.storage != 0 || dr.tariff != 0 || !dr.numeric {
+			continue
+		}
+		q, scale, ok := quantity(dr.vif, dr.vife)
+		if !ok {
+			continue
+		}
+		records = append(records, Record{Quantity: q, Device: dr.device, Value: dr.value * scale})
+	}
+	return records, nil
+}
+
+// quantity maps a VIF and its VIFE to a quantity and the scale to the normalized unit.
+// Records with other VIFE than direction and scale corrections, for example limits or
+// durations, are not current values and are skipped.
+func quantity(vif byte, vife []byte) (Quantity, float64, bool) {
+	var q Quantity
+	var scale float64
+	var ok bool
+	switch vif & 0x7f {
+	case 0x7b: // 0xFB first extension table
+		if len(vife) == 0 {
+			return "", 0, false
+		}
+		q, scale, ok = extensionFB(vife[0] & 0x7f)
+		vife = vife[1:]
+	case 0x7d: // 0xFD second extension table
+		if len(vife) == 0 {
+			return "", 0, false
+		}
+		q, scale, ok = extensionFD(vife[0] & 0x7f)
+		vife = vife[1:]
+	default:
+		q, scale, ok = primary(vif & 0x7f)
+	}
+	if !ok {
+		return "", 0, false
+	}
+
+	for _, e := range vife {
+		e &= 0x7f
+		switch {
+		case e == 0x3b: // accumulation only if positive contributions
+		case e == 0x3c: // accumulation only if negative contributions
+			switch q {
+			case QuantityEnergy:
+				q = QuantityExportEnergy
+			case QuantityPower:
+				q = QuantityExportPower
+			case QuantityReactiveEnergy:
+				q = QuantityReactiveExportEnergy
+			default:
+				return "", 0, false
+			}
+		case e >= 0x70 && e <= 0x77: // multiplicative correction factor 10^(nnn-6)
+			scale *= math.Pow10(int(e&0x07) - 6)
+		case e == 0x7d: // multiplicative correction factor 10^3
+			scale *= 1000
+		default:
+			return "", 0, false
+		}
+	}
+	return q, scale, true
+}
+
+// primary maps the primary VIF table.
+func primary(vif byte) (Quantity, float64, bool) {
+	n := int(vif & 0x07)
+	switch vif & 0x78 {
+	case 0x00: // E000 0nnn Wh
+		return QuantityEnergy, math.Pow10(n - 3), true
+	case 0x08: // E000 1nnn J
+		return QuantityEnergy, math.Pow10(n) / 3600, true
+	case 0x10: // E001 0nnn m3
+		return QuantityVolume, math.Pow10(n - 6), true
+	case 0x28: // E010 1nnn W
+		return QuantityPower, math.Pow10(n - 3), true
+	case 0x30: // E011 0nnn J/h
+		return QuantityPower, math.Pow10(n) / 3600, true
+	case 0x38: // E011 1nnn m3/h
+		return QuantityVolumeFlow, math.Pow10(n - 6), true
+	case 0x40: // E100 0nnn m3/min
+		return QuantityVolumeFlow, math.Pow10(n-7) * 60, true
+	case 0x48: // E100 1nnn m3/s
+		return QuantityVolumeFlow, math.Pow10(n-9) * 3600, true
+	}
+	nn := int(vif & 0x03)
+	switch vif & 0x7c {
+	case 0x58: // E101 10nn C
+		return QuantityFlowTemperature, math.Pow10(nn - 3), true
+	case 0x5c: // E101 11nn C
+		return QuantityReturnTemperature, math.Pow10(nn - 3), true
+	case 0x60: // E110 00nn K
+		return QuantityTempDifference, math.Pow10(nn - 3), true
+	}
+	return "", 0, false
+}
+
+// extensionFB maps the first VIFE after VIF 0xFB.
+func extensionFB(vife byte) (Quantity, float64, bool) {
+	switch {
+	case vife&0x7e == 0x00: // E000 000n 10^(n-1) MWh
+		return QuantityEnergy, math.Pow10(int(vife&0x01) + 5), true
+	case vife&0x7e == 0x02: // E000 001n 10^n kvarh
+		return QuantityReactiveEnergy, math.Pow10(int(vife&0x01) + 3), true
+	case vife&0x7c == 0x14: // E001 01nn 10^(nn-3) kvar
+		return QuantityReactivePower, math.Pow10(int(vife & 0x03)), true
+	}
+	return "", 0, false
+}
+
+// extensionFD maps the first VIFE after VIF 0xFD.
+func extensionFD(vife byte) (Quantity, float64, bool) {
+	switch vife & 0x70 {
+	case 0x40: // E100 nnnn V
+		return QuantityVoltage, math.Pow10(int(vife&0x0f) - 9), true
+	case 0x50: // E101 nnnn A
+		return QuantityCurrent, math.Pow10(int(vife&0x0f) - 12), true
+	}
+	return "", 0, false
+}
+
+// modelOverrides are applied after the generic mapping for meters which use the subunit in a non obvious way.
+var modelOverrides = map[string]func(data *meter.Data, records []Record){
+	"garo-GNM3D-MBUS": func(data *meter.Data, records []Record) {
+		// subunit 4 is line to line voltage.
+		if r, ok := find(records, QuantityVoltage, 4); ok {
+			data.Current_VLL = r.Value
+		}
+	},
+	"kamstrup-multical-403": heatMeter,
+	"kamstrup-multical-603": heatMeter,
+	"diehl-sharky-774":      heatMeter,
+	"diehl-sharky-775":      heatMeter,
+}
+
+// waterHeatCapacity is the heat capacity of water in W per m3/h and kelvin.
+const waterHeatCapacity = 1163
+
+// heatMeter calculates thermal power from flow and temperature difference for meters
+// which are configured to not send power.
+func heatMeter(data *meter.Data, records []Record) {
+	if _, ok := find(records, QuantityPower, 0); ok {
+		return
+	}
+	_, hasFlow := find(records, QuantityVolumeFlow, 0)
+	if !hasFlow {
+		return
+	}
+	deltaT := data.Supply_C - data.Return_C
+	if r, ok := find(records, QuantityTempDifference, 0); ok {
+		deltaT = r.Value
+	}
+	data.Current_W = data.Flow_M3H * deltaT * waterHeatCapacity
+}
+
+// Apply maps records to data. The first record of each quantity and subunit wins.
+func Apply(model string, data *meter.Data, records []Record) {
+	set := func(field *float64, q Quantity, device int) {
+		if r, ok := find(records, q, device); ok {
+			*field = r.Value
+		}
+	}
+
+	set(&data.Total_WH, QuantityEnergy, 0)
+	set(&data.Export_WH, QuantityExportEnergy, 0)
+	set(&data.Current_W, QuantityPower, 0)
+	set(&data.L1_W, QuantityPower, 1)
+	set(&data.L2_W, QuantityPower, 2)
+	set(&data.L3_W, QuantityPower, 3)
+	set(&data.Reactive_Import_VARH, QuantityReactiveEnergy, 0)
+	set(&data.Reactive_Export_VARH, QuantityReactiveExportEnergy, 0)
+	set(&data.Reactive_VAR, QuantityReactivePower, 0)
+	set(&data.L1_VAR, QuantityReactivePower, 1)
+	set(&data.L2_VAR, QuantityReactivePower, 2)
+	set(&data.L3_VAR, QuantityReactivePower, 3)
+	set(&data.Current_VLN, QuantityVoltage, 0)
+	set(&data.L1_V, QuantityVoltage, 1)
+	set(&data.L2_V, QuantityVoltage, 2)
+	set(&data.L3_V, QuantityVoltage, 3)
+	set(&data.L1_A, QuantityCurrent, 1)
+	set(&data.L2_A, QuantityCurrent, 2)
+	set(&data.L3_A, QuantityCurrent, 3)
+	set(&data.Volume_M3, QuantityVolume, 0)
+	set(&data.Flow_M3H, QuantityVolumeFlow, 0)
+	set(&data.Supply_C, QuantityFlowTemperature, 0)
+	set(&data.Return_C, QuantityReturnTemperature, 0)
+
+	// meters with a separate export power record report power in both directions.
+	// Current_W is import minus export like the other sources.
+	if r, ok := find(records, QuantityExportPower, 0); ok {
+		data.Import_W = data.Current_W
+		data.Export_W = r.Value
+		data.Current_W -= r.Value
+	}
+
+	if override, ok := modelOverrides[model]; ok {
+		override(data, records)
+	}
+}
+
+func find(records []Record, q Quantity, device int) (Record, bool) {
+	for _, r := range records {
+		if r.Quantity == q && r.Device == device {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
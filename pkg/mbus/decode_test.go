@@ -0,0 +1,216 @@
+package mbus
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jonaz/gombus"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/stretchr/testify/assert"
+)
+
+// garoFrame is the first response from a Garo GNM3D.
+const garoFrame = `68 65 65 68 08 01 72 14 21 07 90 36 1c c7 02 4d 00 00 00 04 05 9c 31 01 00 04 fb 82 75 63 91 00 00 04 2a 36 08 00 00 04 fb 97 72 ca fe ff ff 04 fb b7 72 6d 08 00 00 02 fd ba 73 dc 03 84 80 80 40 fd 48 c4 0f 00 00 04 fd 48 1a 09 00 00 84 40 fd 59 d2 04 00 00 84 80 40 fd 59 78 00 00 00 84 c0 40 fd 59 00 00 00 00 1f 95 16`
+
+func decodeHex(t *testing.T, s string) []Record {
+	data, err := hex.DecodeString(stripSpaces(s))
+	assert.NoError(t, err)
+	records, err := Decode(gombus.LongFrame(data))
+	assert.NoError(t, err)
+	return records
+}
+
+func TestDecodeGaro(t *testing.T) {
+	records := decodeHex(t, garoFrame)
+	assert.Len(t, records, 9) // apparent power and power factor are skipped
+	assert.Equal(t, Record{Quantity: QuantityEnergy, Device: 0, Value: 7823600}, records[0])
+	assert.Equal(t, QuantityReactiveEnergy, records[1].Quantity) // fb 82 75: kvarh with correction 10^-1
+	assert.InDelta(t, 3721900, records[1].Value, 0.001)
+	assert.Equal(t, QuantityPower, records[2].Quantity)
+	assert.InDelta(t, 210.2, records[2].Value, 0.001)
+	assert.Equal(t, QuantityReactivePower, records[3].Quantity) // fb 97 72: kvar with correction 10^-4
+	assert.InDelta(t, -31.0, records[3].Value, 0.001)
+
+	data := &meter.Data{}
+	Apply("garo-GNM3D-MBUS", data, records)
+	assert.Equal(t, 7823600.0, data.Total_WH)
+	assert.InDelta(t, 210.2, data.Current_W, 0.001)
+	assert.InDelta(t, 3721900, data.Reactive_Import_VARH, 0.001)
+	assert.InDelta(t, -31.0, data.Reactive_VAR, 0.001)
+	assert.InDelta(t, 403.6, data.Current_VLL, 0.001)
+	assert.InDelta(t, 233.0, data.Current_VLN, 0.001)
+	assert.InDelta(t, 1.234, data.L1_A, 0.001)
+	assert.InDelta(t, 0.12, data.L2_A, 0.001)
+	assert.Equal(t, 0.0, data.L3_A)
+}
+
+func TestApplyGeneric(t *testing.T) {
+	records := []Record{
+		{Quantity: QuantityEnergy, Value: 1000},
+		{Quantity: QuantityEnergy, Value: 2000}, // second energy register is ignored
+		{Quantity: QuantityPower, Value: 500},
+		{Quantity: QuantityPower, Device: 1, Value: 100},
+		{Quantity: QuantityPower, Device: 3, Value: 400},
+		{Quantity: QuantityVoltage, Device: 4, Value: 400},
+		{Quantity: QuantityVoltage, Device: 1, Value: 231},
+		{Quantity: QuantityVoltage, Device: 2, Value: 232},
+		{Quantity: QuantityVoltage, Device: 3, Value: 233},
+		{Quantity: QuantityCurrent, Device: 3, Value: 3},
+	}
+	data := &meter.Data{}
+	Apply("unknown", data, records)
+	assert.Equal(t, &meter.Data{
+		Total_WH:  1000,
+		Current_W: 500,
+		L1_W:      100,
+		L3_W:      400,
+		L1_V:      231,
+		L2_V:      232,
+		L3_V:      233,
+		L3_A:      3,
+	}, data)
+}
+
+func TestQuantity(t *testing.T) {
+	tests := []struct {
+		vif      byte
+		vife     []byte
+		quantity Quantity
+		scale    float64
+		ok       bool
+	}{
+		{0x0e, nil, QuantityEnergy, 1e6 / 3600, true},                       // 10^6 J
+		{0x43, nil, QuantityVolumeFlow, 1e-4 * 60, true},                    // 10^-4 m3/min
+		{0x5a, nil, QuantityFlowTemperature, 0.1, true},                     // 10^-1 C
+		{0x5e, nil, QuantityReturnTemperature, 0.1, true},                   // 10^-1 C
+		{0x65, nil, "", 0, false},                                           // external temperature
+		{0x83, []byte{0x3c}, QuantityExportEnergy, 1, true},                 // Wh only negative contributions
+		{0x83, []byte{0xbb, 0x74}, QuantityEnergy, 0.01, true},              // Wh only positive contributions, 10^-2
+		{0xab, []byte{0x3c}, QuantityExportPower, 1, true},                  // W only negative contributions
+		{0xfb, []byte{0x83, 0x3c}, QuantityReactiveExportEnergy, 1e4, true}, // 10 kvarh only negative contributions
+		{0xfb, []byte{0x17}, QuantityReactivePower, 1000, true},             // kvar
+		{0xfb, []byte{0x01}, QuantityEnergy, 1e6, true},                     // MWh
+		{0xfd, []byte{0x48}, QuantityVoltage, 0.1, true},                    // 10^-1 V
+		{0xfd, []byte{0x59}, QuantityCurrent, 0.001, true},                  // 10^-3 A
+		{0xfd, []byte{0x3a}, "", 0, false},                                  // dimensionless
+		{0x83, []byte{0x40}, "", 0, false},                                  // lower limit
+		{0x5a, []byte{0x3c}, "", 0, false},                                  // direction of a temperature
+	}
+	for _, tt := range tests {
+		q, scale, ok := quantity(tt.vif, tt.vife)
+		assert.Equal(t, tt.quantity, q, "% x % x", tt.vif, tt.vife)
+		assert.InDelta(t, tt.scale, scale, 1e-9, "% x % x", tt.vif, tt.vife)
+		assert.Equal(t, tt.ok, ok, "% x % x", tt.vif, tt.vife)
+	}
+}
+
+func TestDecodeExport(t *testing.T) {
+	frame := longFrame(t, strings.Join([]string{
+		"04 06 10 27 00 00",       // energy 10000 kWh
+		"04 86 3c e8 03 00 00",    // export energy 1000 kWh
+		"03 2b 10 27 00",          // power 10000 W as 24 bit integer
+		"03 ab 3c 50 c3 00",       // export power 50000 W
+		"84 40 ab 3c 88 13 00 00", // export power L1 is not used
+		"0d fd 0c 04 31 32 33 34", // model as string is skipped
+	}, " "))
+	data := &meter.Data{}
+	Apply("unknown", data, decodeHex(t, frame))
+	assert.Equal(t, 10000000.0, data.Total_WH)
+	assert.Equal(t, 1000000.0, data.Export_WH)
+	assert.Equal(t, 10000.0, data.Import_W)
+	assert.Equal(t, 50000.0, data.Export_W)
+	assert.Equal(t, -40000.0, data.Current_W)
+}
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		coding byte
+		data   string
+		value  float64
+		ok     bool
+	}{
+		{0x01, "ff", -1, true},
+		{0x02, "ca fe", -310, true},
+		{0x03, "00 00 80", -8388608, true},
+		{0x06, "01 00 00 00 00 00", 1, true},
+		{0x05, "00 00 20 41", 10, true},
+		{0x0b, "56 34 12", 123456, true},
+		{0x0a, "34 f2", -234, true},
+		{0x0a, "3a 12", 0, false},
+	}
+	for _, tt := range tests {
+		b, err := hex.DecodeString(stripSpaces(tt.data))
+		assert.NoError(t, err)
+		v, ok := decodeValue(tt.coding, b)
+		assert.Equal(t, tt.value, v, tt.data)
+		assert.Equal(t, tt.ok, ok, tt.data)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(gombus.LongFrame{0x10, 0x7b, 0x01, 0x7c, 0x16})
+	assert.ErrorContains(t, err, "not a variable data response")
+
+	frame, err := hex.DecodeString(longFrame(t, "04 06 39 30"))
+	assert.NoError(t, err)
+	_, err = Decode(frame)
+	assert.EqualError(t, err, "mbus data record truncated at 2")
+}
+
+// longFrame wraps records in a variable data response from a Kamstrup heat meter with id 12345678.
+func longFrame(t *testing.T, records string) string {
+	body, err := hex.DecodeString(stripSpaces("08 01 72 78 56 34 12 2d 2c 35 04 01 00 00 00 " + records))
+	assert.NoError(t, err)
+	var cs byte
+	for _, b := range body {
+		cs += b
+	}
+	l := byte(len(body))
+	frame := append([]byte{0x68, l, l, 0x68}, body...)
+	return hex.EncodeToString(append(frame, cs, 0x16))
+}
+
+func TestDecodeHeatMeter(t *testing.T) {
+	frame := longFrame(t, strings.Join([]string{
+		"04 06 39 30 00 00", // energy 12345 kWh
+		"04 14 40 e2 01 00", // volume 1234.56 m3
+		"04 2d 19 00 00 00", // power 2.5 kW
+		"04 3b ae 01 00 00", // flow 430 l/h
+		"02 59 a0 11",       // flow temperature 45.12 C
+		"02 5d 32 0f",       // return temperature 38.90 C
+		"02 61 6e 02",       // temperature difference 6.22 K
+		"44 06 e0 2e 00 00", // energy at storage 1 is ignored
+	}, " "))
+
+	data := &meter.Data{}
+	Apply("kamstrup-multical-603", data, decodeHex(t, frame))
+	assert.InDelta(t, 12345000, data.Total_WH, 0.001)
+	assert.InDelta(t, 1234.56, data.Volume_M3, 0.001)
+	assert.InDelta(t, 2500, data.Current_W, 0.001)
+	assert.InDelta(t, 0.43, data.Flow_M3H, 0.001)
+	assert.InDelta(t, 45.12, data.Supply_C, 0.001)
+	assert.InDelta(t, 38.90, data.Return_C, 0.001)
+}
+
+func TestDecodeHeatMeterWithoutPower(t *testing.T) {
+	frame := longFrame(t, strings.Join([]string{
+		"04 06 39 30 00 00", // energy 12345 kWh
+		"04 3b e8 03 00 00", // flow 1000 l/h
+		"02 59 a0 0f",       // flow temperature 40.00 C
+		"02 5d b0 04",       // return temperature 12.00 C
+	}, " "))
+
+	data := &meter.Data{}
+	Apply("diehl-sharky-775", data, decodeHex(t, frame))
+	assert.InDelta(t, 1.0, data.Flow_M3H, 0.001)
+	assert.InDelta(t, 28*1163, data.Current_W, 0.01)
+
+	data = &meter.Data{}
+	Apply("unknown", data, decodeHex(t, frame))
+	assert.Equal(t, 0.0, data.Current_W)
+}
+
+func stripSpaces(s string) string {
+	return strings.ReplaceAll(s, " ", "")
+}
@@ -1,32 +1,76 @@
 package mbus
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jonaz/gombus"
+	"github.com/jonaz/serial"
 	"github.com/nergy-se/controller/pkg/api/v1/meter"
 )
 
+const (
+	DefaultDevice   = "/dev/ttyAMA0"
+	DefaultBaudRate = 2400
+)
+
+// tcpPrefix can be used to force a TCP connection. Devices in host:port format are also TCP.
+const tcpPrefix = "tcp://"
+
+// Mbus is one M-Bus master on a serial device or a M-Bus/TCP gateway. Requests on the same bus are serialized.
 type Mbus struct {
-	conn  gombus.Conn
-	mutex *sync.Mutex
+	device   string
+	tcp      bool
+	baudRate int
+	conn     gombus.Conn
+	mutex    *sync.Mutex
+
+	// ackTimeout is how long we wait for all slaves to answer a secondary address selection.
+	ackTimeout time.Duration
 }
 
-func New() *Mbus {
+func New(device string, baudRate int) *Mbus {
+	if device == "" {
+		device = DefaultDevice
+	}
+	if baudRate == 0 {
+		baudRate = DefaultBaudRate
+	}
+	device, tcp := parseDevice(device)
 	return &Mbus{
-		mutex: &sync.Mutex{},
+		device:     device,
+		tcp:        tcp,
+		baudRate:   baudRate,
+		mutex:      &sync.Mutex{},
+		ackTimeout: 500 * time.Millisecond,
 	}
 }
 
-func (m *Mbus) init() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// Device is the serial device of the bus.
+func (m *Mbus) Device() string {
+	return m.device
+}
+
+// connect dials the bus unless already connected. The connection is closed by reset after
+// connection errors, so it must be checked while holding m.mutex before every request.
+func (m *Mbus) connect() error {
 	if m.conn != nil {
 		return nil
 	}
-	c, err := gombus.DialSerial("/dev/ttyAMA0")
+	var c gombus.Conn
+	var err error
+	if m.tcp {
+		c, err = gombus.DialTCP(m.device)
+	} else {
+		c, err = dialSerial(m.device, m.baudRate)
+	}
 	if err != nil {
 		return err
 	}
@@ -34,6 +78,44 @@ func (m *Mbus) init() error {
 	return nil
 }
 
+// parseDevice returns the device without tcp:// prefix and if it is a TCP address.
+func parseDevice(device string) (string, bool) {
+	if strings.HasPrefix(device, tcpPrefix) {
+		return strings.TrimPrefix(device, tcpPrefix), true
+	}
+	return device, !strings.HasPrefix(device, "/") && strings.Contains(device, ":")
+}
+
+// reset closes the connection after connection errors so the next request reconnects.
+// A TCP gateway might have dropped the connection.
+func (m *Mbus) reset(err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return
+	}
+	if netErr == nil && !errors.Is(err, io.EOF) {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+}
+
+// dialSerial is the same as gombus.DialSerial but with configurable baud rate.
+func dialSerial(device string, baudRate int) (gombus.Conn, error) {
+	// Even, 8, 1, None
+	return serial.OpenPort(&serial.Config{
+		Name:     device,
+		Baud:     baudRate,
+		Size:     8,
+		StopBits: 1,
+		Parity:   serial.ParityEven,
+	})
+}
+
 func (m *Mbus) Close() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -45,44 +127,51 @@ func (m *Mbus) Close() error {
 	return nil
 }
 
-func (m *Mbus) ReadValues(model, idStr string) (*meter.Data, error) {
-	err := m.init()
-	if err != nil {
-		return nil, err
+// ReadValues reads the meter using secondaryID if set otherwise primaryID.
+// Nothing is sent if ctx is done when the bus becomes free.
+func (m *Mbus) ReadValues(ctx context.Context, model, primaryID, secondaryID string) (*meter.Data, error) {
+	var frame gombus.LongFrame
+	var err error
+	id := primaryID
+	if secondaryID != "" {
+		id = secondaryID
+		frame, err = m.readSecondary(ctx, secondaryID)
+	} else {
+		frame, err = m.readPrimary(ctx, primaryID)
 	}
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		return nil, err
-	}
-
-	frame, err := m.read(id)
+	m.reset(err)
 	if err != nil {
 		return nil, err
 	}
 
 	data := &meter.Data{
-		Id:    idStr,
+		Id:    id,
 		Model: model,
 		Time:  time.Now(),
 	}
-	switch model {
-	case "garo-GNM3D-MBUS":
-		data.Total_WH = frame.DataRecords[0].Value
-		data.Current_W = frame.DataRecords[2].Value
-		data.Current_VLL = frame.DataRecords[6].Value
-		data.Current_VLN = frame.DataRecords[7].Value
-		data.L1_A = frame.DataRecords[8].Value
-		data.L2_A = frame.DataRecords[9].Value
-		data.L3_A = frame.DataRecords[10].Value
+	records, err := Decode(frame)
+	if err != nil {
+		return nil, err
 	}
+	Apply(model, data, records)
 
 	return data, nil
 }
 
-func (m *Mbus) read(primaryAddr int) (*gombus.DecodedFrame, error) {
+func (m *Mbus) readPrimary(ctx context.Context, idStr string) (gombus.LongFrame, error) {
+	primaryAddr, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, err
+	}
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	_, err := m.conn.Write(gombus.SndNKE(uint8(primaryAddr)))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	_, err = m.conn.Write(gombus.SndNKE(uint8(primaryAddr)))
 	if err != nil {
 		return nil, err
 	}
@@ -97,5 +186,36 @@ func (m *Mbus) read(primaryAddr int) (*gombus.DecodedFrame, error) {
 		return nil, err
 	}
 
-	return gombus.ReadSingleFrame(m.conn, primaryAddr)
+	if _, err := m.conn.Write(gombus.RequestUD2(uint8(primaryAddr))); err != nil {
+		return nil, err
+	}
+	return gombus.ReadLongFrame(m.conn)
+}
+
+func (m *Mbus) readSecondary(ctx context.Context, secondaryID string) (gombus.LongFrame, error) {
+	addr, err := ParseSecondary(secondaryID)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+
+	result, err := m.probe(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch result {
+	case probeNone:
+		return nil, fmt.Errorf("no mbus device with secondary address %s", secondaryID)
+	case probeCollision:
+		return nil, fmt.Errorf("more than one mbus device matches secondary address %s", secondaryID)
+	}
+
+	return m.readSelected()
 }
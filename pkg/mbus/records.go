@@ -0,0 +1,165 @@
+package mbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// dataRecord is one data record from the user data of a variable data response.
+type dataRecord struct {
+	function int // 0 instantaneous, 1 maximum, 2 minimum, 3 value during error
+	storage  int
+	tariff   int
+	device   int // subunit
+	vif      byte
+	vife     []byte
+	value    float64
+	numeric  bool // false for strings and data types without value
+}
+
+// parseRecords splits the user data of a variable data response in data records.
+// Parsing stops at manufacturer specific data.
+func parseRecords(data []byte) ([]dataRecord, error) {
+	var records []dataRecord
+	i := 0
+	next := func() (byte, error) {
+		if i >= len(data) {
+			return 0, fmt.Errorf("mbus data record truncated at %d", i)
+		}
+		b := data[i]
+		i++
+		return b, nil
+	}
+	for i < len(data) {
+		dif := data[i]
+		i++
+		if dif == 0x2f { // idle filler
+			continue
+		}
+		if dif&0x0f == 0x0f { // manufacturer specific data or global readout
+			break
+		}
+
+		dr := dataRecord{
+			function: int(dif>>4) & 0x03,
+			storage:  int(dif>>6) & 0x01,
+		}
+		ext := dif
+		for n := 0; ext&0x80 != 0; n++ {
+			dife, err := next()
+			if err != nil {
+				return nil, err
+			}
+			dr.storage |= int(dife&0x0f) << (1 + 4*n)
+			dr.tariff |= int(dife>>4&0x03) << (2 * n)
+			dr.device |= int(dife>>6&0x01) << n
+			ext = dife
+		}
+
+		vif, err := next()
+		if err != nil {
+			return nil, err
+		}
+		dr.vif = vif
+		for ext = vif; ext&0x80 != 0; {
+			if ext, err = next(); err != nil {
+				return nil, err
+			}
+			dr.vife = append(dr.vife, ext)
+		}
+		if vif&0x7f == 0x7c { // plain text unit
+			l, err := next()
+			if err != nil {
+				return nil, err
+			}
+			i += int(l)
+		}
+
+		size, err := dataSize(dif, data[min(i, len(data)):])
+		if err != nil {
+			return nil, err
+		}
+		if i+size > len(data) {
+			return nil, fmt.Errorf("mbus data record truncated at %d", i)
+		}
+		dr.value, dr.numeric = decodeValue(dif&0x0f, data[i:i+size])
+		i += size
+		records = append(records, dr)
+	}
+	return records, nil
+}
+
+// dataSize returns the length of the data field. Variable length data starts with the LVAR byte.
+func dataSize(dif byte, data []byte) (int, error) {
+	switch dif & 0x0f {
+	case 0x00, 0x08:
+		return 0, nil
+	case 0x01, 0x09:
+		return 1, nil
+	case 0x02, 0x0a:
+		return 2, nil
+	case 0x03, 0x0b:
+		return 3, nil
+	case 0x04, 0x05, 0x0c:
+		return 4, nil
+	case 0x06, 0x0e:
+		return 6, nil
+	case 0x07:
+		return 8, nil
+	case 0x0d:
+		if len(data) == 0 {
+			return 0, fmt.Errorf("mbus variable length data without LVAR")
+		}
+		lvar := int(data[0])
+		switch {
+		case lvar <= 0xbf:
+			return 1 + lvar, nil
+		case lvar <= 0xcf: // (LVAR-C0) * 2 BCD digits
+			return 1 + lvar - 0xc0, nil
+		case lvar <= 0xdf: // negative BCD
+			return 1 + lvar - 0xd0, nil
+		case lvar <= 0xef:
+			return 1 + lvar - 0xe0, nil
+		case lvar <= 0xfa:
+			return 1 + lvar - 0xf0, nil
+		}
+		return 0, fmt.Errorf("mbus reserved LVAR %02x", lvar)
+	}
+	return 0, fmt.Errorf("mbus unknown data field %02x", dif)
+}
+
+// decodeValue decodes integers, real and BCD. Integers are little endian two's complement.
+// BCD with F as the most significant digit is negative.
+func decodeValue(coding byte, b []byte) (float64, bool) {
+	switch coding {
+	case 0x01, 0x02, 0x03, 0x04, 0x06, 0x07:
+		var v uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		shift := 64 - 8*len(b)
+		return float64(int64(v<<shift) >> shift), true
+	case 0x05:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), true
+	case 0x09, 0x0a, 0x0b, 0x0c, 0x0e:
+		var v float64
+		negative := false
+		for i := len(b) - 1; i >= 0; i-- {
+			hi, lo := b[i]>>4, b[i]&0x0f
+			if i == len(b)-1 && hi == 0x0f {
+				negative = true
+				hi = 0
+			}
+			if hi > 9 || lo > 9 {
+				return 0, false
+			}
+			v = v*100 + float64(hi)*10 + float64(lo)
+		}
+		if negative {
+			v = -v
+		}
+		return v, true
+	}
+	return 0, false
+}
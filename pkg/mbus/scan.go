@@ -0,0 +1,205 @@
+package mbus
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonaz/gombus"
+	"github.com/sirupsen/logrus"
+)
+
+// addressSelected is the primary address used to talk to the slave selected with secondary addressing.
+const addressSelected = 0xFD
+
+// Wildcard matches any secondary address.
+const Wildcard = "FFFFFFFFFFFFFFFF"
+
+// Device is a meter found on the bus.
+type Device struct {
+	PrimaryID    int    `json:"primaryId"`
+	SecondaryID  string `json:"secondaryId"`
+	ID           string `json:"id"`
+	Manufacturer string `json:"manufacturer"`
+	Version      int    `json:"version"`
+	Medium       string `json:"medium"`
+}
+
+// ScanResult is all devices found on one bus.
+type ScanResult struct {
+	Device  string   `json:"device"`
+	Devices []Device `json:"devices"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// ParseSecondary parses a secondary address in the same format as libmbus: 8 digit id followed by
+// manufacturer, version and medium as in the frame. Example 90072114361CC702. F is a wildcard.
+func ParseSecondary(s string) ([]byte, error) {
+	s = strings.ToUpper(s)
+	if len(s) != 16 {
+		return nil, fmt.Errorf("secondary address must be 16 characters got %d", len(s))
+	}
+	for _, c := range s[:8] {
+		if (c < '0' || c > '9') && c != 'F' {
+			return nil, fmt.Errorf("secondary address id must be digits or F got %s", s[:8])
+		}
+	}
+	addr, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing secondary address %s: %w", s, err)
+	}
+	// id is BCD with least significant byte first.
+	addr[0], addr[1], addr[2], addr[3] = addr[3], addr[2], addr[1], addr[0]
+	return addr, nil
+}
+
+// secondaryAddress formats the secondary address of a response frame.
+func secondaryAddress(frame gombus.LongFrame) string {
+	id := []byte{frame[10], frame[9], frame[8], frame[7]}
+	return strings.ToUpper(hex.EncodeToString(id) + hex.EncodeToString(frame[11:15]))
+}
+
+// selectFrame selects the slave with secondary address addr.
+func selectFrame(addr []byte) gombus.LongFrame {
+	frame := gombus.LongFrame{0x68, 0x00, 0x00, 0x68, 0x53, addressSelected, 0x52}
+	frame = append(frame, addr...)
+	frame = append(frame, 0x00, 0x16)
+	frame.SetLength()
+	frame.SetChecksum()
+	return frame
+}
+
+type probeResult int
+
+const (
+	probeNone probeResult = iota
+	probeSingle
+	probeCollision
+)
+
+// probe selects addr and checks how many slaves answered.
+func (m *Mbus) probe(addr []byte) (probeResult, error) {
+	if _, err := m.conn.Write(selectFrame(addr)); err != nil {
+		return probeNone, err
+	}
+	var resp []byte
+	buf := make([]byte, 256)
+	err := m.conn.SetReadDeadline(time.Now().Add(m.ackTimeout))
+	if err != nil {
+		return probeNone, err
+	}
+	for {
+		n, err := m.conn.Read(buf)
+		resp = append(resp, buf[:n]...)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return probeNone, err
+		}
+	}
+
+	switch {
+	case len(resp) == 0:
+		return probeNone, nil
+	case len(resp) == 1 && resp[0] == gombus.SingleCharacterFrame:
+		return probeSingle, nil
+	}
+	return probeCollision, nil
+}
+
+// readSelected reads the first frame from the selected slave.
+func (m *Mbus) readSelected() (gombus.LongFrame, error) {
+	if _, err := m.conn.Write(gombus.RequestUD2(addressSelected)); err != nil {
+		return nil, err
+	}
+	return gombus.ReadLongFrame(m.conn)
+}
+
+// Scan finds all meters on the bus using secondary address wildcard search.
+// The bus is only locked during each probe so meters can be read while scanning.
+func (m *Mbus) Scan() ([]Device, error) {
+	mask := []byte(Wildcard)
+	var devices []Device
+	err := m.scan(mask, 0, &devices)
+	m.reset(err)
+	return devices, err
+}
+
+// probeDevice probes mask and reads the device if exactly one slave answered.
+// Devices which can not be read are logged and skipped.
+func (m *Mbus) probeDevice(mask []byte) (probeResult, *Device, error) {
+	addr, err := ParseSecondary(string(mask))
+	if err != nil {
+		return probeNone, nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.connect(); err != nil {
+		return probeNone, nil, err
+	}
+	result, err := m.probe(addr)
+	if err != nil || result != probeSingle {
+		return result, nil, err
+	}
+	device, err := m.readDevice()
+	if err != nil {
+		logrus.Errorf("error reading mbus device %s: %s", mask, err)
+		return result, nil, nil
+	}
+	return result, &device, nil
+}
+
+func (m *Mbus) scan(mask []byte, pos int, devices *[]Device) error {
+	for digit := byte('0'); digit <= '9'; digit++ {
+		mask[pos] = digit
+		result, device, err := m.probeDevice(mask)
+		if err != nil {
+			return err
+		}
+		switch result {
+		case probeSingle:
+			if device != nil {
+				*devices = append(*devices, *device)
+			}
+		case probeCollision:
+			if pos == 7 {
+				logrus.Warnf("mbus collision on %s. devices with same id cannot be separated", mask)
+				continue
+			}
+			if err := m.scan(mask, pos+1, devices); err != nil {
+				return err
+			}
+		}
+	}
+	mask[pos] = 'F'
+	return nil
+}
+
+func (m *Mbus) readDevice() (Device, error) {
+	frame, err := m.readSelected()
+	if err != nil {
+		return Device{}, err
+	}
+	if len(frame) < 19 {
+		return Device{}, fmt.Errorf("frame too short: % x", frame)
+	}
+	device := Device{
+		PrimaryID:   int(frame.A()),
+		SecondaryID: secondaryAddress(frame),
+		Version:     int(frame[13]),
+		Medium:      fmt.Sprintf("%02X", frame[14]),
+	}
+	device.ID = device.SecondaryID[:8]
+	device.Manufacturer, err = frame.DecodeManufacturer()
+	if err != nil {
+		return Device{}, err
+	}
+	if decoded, err := frame.Decode(); err == nil {
+		device.Medium = decoded.DeviceType
+	}
+	return device, nil
+}
@@ -0,0 +1,164 @@
+package mbus
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonaz/gombus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBus answers secondary address selection and REQ_UD2 like slaves on a real bus.
+type fakeBus struct {
+	frames   []gombus.LongFrame
+	selected gombus.LongFrame
+	out      []byte
+	onSelect func() // called on every secondary address selection
+}
+
+func (f *fakeBus) matches(addr []byte, frame gombus.LongFrame) bool {
+	for i, a := range addr {
+		b := frame[7+i]
+		if i < 4 {
+			if a&0xF0 != 0xF0 && a&0xF0 != b&0xF0 || a&0x0F != 0x0F && a&0x0F != b&0x0F {
+				return false
+			}
+			continue
+		}
+		if a != 0xFF && a != b {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeBus) Write(b []byte) (int, error) {
+	switch {
+	case len(b) == 17 && b[6] == 0x52:
+		if f.onSelect != nil {
+			f.onSelect()
+		}
+		var found []gombus.LongFrame
+		for _, frame := range f.frames {
+			if f.matches(b[7:15], frame) {
+				found = append(found, frame)
+			}
+		}
+		switch len(found) {
+		case 0:
+		case 1:
+			f.selected = found[0]
+			f.out = []byte{gombus.SingleCharacterFrame}
+		default:
+			f.out = []byte{0xe5, 0x53} // garbage from several slaves answering at once
+		}
+	case len(b) == 5 && b[2] == addressSelected && f.selected != nil:
+		f.out = f.selected
+	}
+	return len(b), nil
+}
+
+func (f *fakeBus) Read(b []byte) (int, error) {
+	if len(f.out) == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(b, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+func (f *fakeBus) SetReadDeadline(t time.Time) error { return nil }
+func (f *fakeBus) Close() error                      { return nil }
+
+func frameFromHex(t *testing.T, s string) gombus.LongFrame {
+	data, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return gombus.LongFrame(data)
+}
+
+func newFakeBus(t *testing.T) (*Mbus, *fakeBus) {
+	kamstrup := frameFromHex(t, longFrame(t, "04 06 39 30 00 00"))
+	other := frameFromHex(t, longFrame(t, "04 06 39 30 00 00"))
+	other[7] = 0x99 // id 12345699
+	other[5] = 0x02
+	other.SetChecksum()
+
+	fake := &fakeBus{frames: []gombus.LongFrame{
+		frameFromHex(t, stripSpaces(garoFrame)),
+		kamstrup,
+		other,
+	}}
+	m := New("/dev/null", 0)
+	m.conn = fake
+	return m, fake
+}
+
+func TestParseSecondary(t *testing.T) {
+	addr, err := ParseSecondary("90072114361cc702")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x14, 0x21, 0x07, 0x90, 0x36, 0x1c, 0xc7, 0x02}, addr)
+
+	addr, err = ParseSecondary(Wildcard)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, addr)
+
+	_, err = ParseSecondary("9007211A361CC702")
+	assert.Error(t, err)
+	_, err = ParseSecondary("1234")
+	assert.Error(t, err)
+}
+
+func TestSelectFrame(t *testing.T) {
+	addr, _ := ParseSecondary("90072114361CC702")
+	assert.Equal(t, "680b0b6853fd5214210790361cc7028916", hex.EncodeToString(selectFrame(addr)))
+}
+
+func TestScan(t *testing.T) {
+	m, _ := newFakeBus(t)
+	devices, err := m.Scan()
+	assert.NoError(t, err)
+	assert.Equal(t, []Device{
+		{PrimaryID: 1, SecondaryID: "123456782D2C3504", ID: "12345678", Manufacturer: "KAM", Version: 0x35, Medium: "Heat: Outlet"},
+		{PrimaryID: 2, SecondaryID: "123456992D2C3504", ID: "12345699", Manufacturer: "KAM", Version: 0x35, Medium: "Heat: Outlet"},
+		{PrimaryID: 1, SecondaryID: "90072114361CC702", ID: "90072114", Manufacturer: "GAV", Version: 0xc7, Medium: "Electricity"},
+	}, devices)
+}
+
+func TestReadValuesSecondary(t *testing.T) {
+	m, _ := newFakeBus(t)
+	data, err := m.ReadValues(context.Background(), "garo-GNM3D-MBUS", "", "90072114361CC702")
+	assert.NoError(t, err)
+	assert.Equal(t, "90072114361CC702", data.Id)
+	assert.Equal(t, 7823600.0, data.Total_WH)
+	assert.InDelta(t, 403.6, data.Current_VLL, 0.001)
+
+	_, err = m.ReadValues(context.Background(), "", "", "FFFFFFFF2D2C3504")
+	assert.EqualError(t, err, "more than one mbus device matches secondary address FFFFFFFF2D2C3504")
+
+	_, err = m.ReadValues(context.Background(), "", "", "11111111FFFFFFFF")
+	assert.EqualError(t, err, "no mbus device with secondary address 11111111FFFFFFFF")
+}
+
+func TestScanReleasesBus(t *testing.T) {
+	m, fake := newFakeBus(t)
+	var readDuringScan atomic.Bool
+	started := false
+	fake.onSelect = func() {
+		if !started {
+			started = true
+			go func() {
+				_, err := m.ReadValues(context.Background(), "garo-GNM3D-MBUS", "", "90072114361CC702")
+				assert.NoError(t, err)
+				readDuringScan.Store(true)
+			}()
+		}
+		time.Sleep(time.Millisecond) // let the reader wait for the bus
+	}
+	_, err := m.Scan()
+	assert.NoError(t, err)
+	assert.True(t, readDuringScan.Load())
+}
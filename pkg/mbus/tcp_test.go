@@ -0,0 +1,134 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jonaz/gombus"
+	"github.com/stretchr/testify/assert"
+)
+
+// gateway is a M-Bus/TCP converter with one slave which answers with frame.
+func gateway(t *testing.T, frame gombus.LongFrame) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 256)
+				for {
+					_, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					switch buf[1] & 0x4f {
+					case 0x40: // SND_NKE
+						_, err = conn.Write([]byte{gombus.SingleCharacterFrame})
+					case 0x4b: // REQ_UD2
+						_, err = conn.Write(frame)
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestReadValuesTCP(t *testing.T) {
+	l := gateway(t, frameFromHex(t, stripSpaces(garoFrame)))
+	defer l.Close()
+
+	buses := NewBuses(DefaultDevice, DefaultBaudRate)
+	defer buses.Close()
+	bus, err := buses.Get("tcp://"+l.Addr().String(), 0)
+	assert.NoError(t, err)
+	assert.True(t, bus.tcp)
+	same, err := buses.Get(l.Addr().String(), 9600) // baud rate does not matter for TCP
+	assert.NoError(t, err)
+	assert.Same(t, bus, same)
+
+	for i := 0; i < 2; i++ { // second read reuses the connection
+		data, err := bus.ReadValues(context.Background(), "garo-GNM3D-MBUS", "1", "")
+		assert.NoError(t, err)
+		assert.Equal(t, 7823600.0, data.Total_WH)
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	tests := []struct {
+		device   string
+		expected string
+		tcp      bool
+	}{
+		{"/dev/ttyAMA0", "/dev/ttyAMA0", false},
+		{"/dev/serial/by-id/usb-FTDI:1", "/dev/serial/by-id/usb-FTDI:1", false},
+		{"192.168.1.10:10001", "192.168.1.10:10001", true},
+		{"tcp://mbus.local:10001", "mbus.local:10001", true},
+	}
+	for _, tt := range tests {
+		device, tcp := parseDevice(tt.device)
+		assert.Equal(t, tt.expected, device)
+		assert.Equal(t, tt.tcp, tcp)
+	}
+}
+
+func TestReset(t *testing.T) {
+	m, fake := newFakeBus(t)
+	m.reset(fmt.Errorf("error reading from connection: %w", os.ErrDeadlineExceeded))
+	assert.Same(t, fake, m.conn)
+	m.reset(fmt.Errorf("no mbus device"))
+	assert.Same(t, fake, m.conn)
+	m.reset(fmt.Errorf("error reading from connection: %w", io.EOF))
+	assert.Nil(t, m.conn)
+}
+
+func TestScanAndReadWithDroppedConnections(t *testing.T) {
+	// gateway which closes every connection after the first request.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				buf := make([]byte, 256)
+				_, _ = conn.Read(buf)
+				conn.Close()
+			}()
+		}
+	}()
+
+	m := New("tcp://"+l.Addr().String(), 0)
+	defer m.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := m.Scan()
+			assert.Error(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := m.ReadValues(context.Background(), "garo-GNM3D-MBUS", "1", "")
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+}
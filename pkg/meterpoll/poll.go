@@ -0,0 +1,160 @@
+package meterpoll
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultSilentAlarm = 15 * time.Minute
+)
+
+type status struct {
+	health    meter.Health
+	lastPoll  time.Time
+	firstPoll time.Time
+}
+
+// Tracker keeps track of when each meter should be polled and its health.
+type Tracker struct {
+	meters map[string]*status
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		meters: make(map[string]*status),
+		now:    time.Now,
+	}
+}
+
+func (t *Tracker) status(m config.Meter) *status {
+	id := m.Identifier()
+	s, ok := t.meters[id]
+	if !ok {
+		s = &status{}
+		t.meters[id] = s
+	}
+	s.health.Id = id
+	s.health.InterfaceType = m.InterfaceType
+	s.health.Model = m.Model
+	return s
+}
+
+// Due returns true and marks the meter as polled if its poll interval has passed.
+// One second of slack is allowed so a poll interval equal to the metrics tick is not skipped due to jitter.
+func (t *Tracker) Due(m config.Meter) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.status(m)
+	now := t.now()
+	interval := time.Duration(m.PollInterval) * time.Second
+	if !s.lastPoll.IsZero() && now.Sub(s.lastPoll)+time.Second < interval {
+		return false
+	}
+	if s.firstPoll.IsZero() {
+		s.firstPoll = now
+	}
+	s.lastPoll = now
+	return true
+}
+
+func (t *Tracker) Success(m config.Meter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.status(m)
+	s.health.LastSuccess = t.now()
+	s.health.ConsecutiveFailures = 0
+}
+
+func (t *Tracker) Failure(m config.Meter, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	s := t.status(m)
+	s.health.ConsecutiveFailures++
+	s.health.LastError = err.Error()
+	s.health.LastErrorTime = t.now()
+}
+
+// Health returns the health of meters in the same order.
+func (t *Tracker) Health(meters []config.Meter) []meter.Health {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	health := make([]meter.Health, len(meters))
+	for i, m := range meters {
+		health[i] = t.status(m).health
+	}
+	return health
+}
+
+// Alarms returns an alarm for each meter which has not been read successfully within its SilentAlarm.
+func (t *Tracker) Alarms(meters []config.Meter) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var alarms []string
+	now := t.now()
+	for _, m := range meters {
+		s := t.status(m)
+		if s.firstPoll.IsZero() {
+			continue
+		}
+		since := s.health.LastSuccess
+		if since.IsZero() {
+			since = s.firstPoll
+		}
+		silentAlarm := DefaultSilentAlarm
+		if m.SilentAlarm > 0 {
+			silentAlarm = time.Duration(m.SilentAlarm) * time.Second
+		}
+		if now.Sub(since) > silentAlarm {
+			alarms = append(alarms, fmt.Sprintf("meter %s %s silent", m.Identifier(), m.Model))
+		}
+	}
+	return alarms
+}
+
+// Retry calls fn until it succeeds or retries are exhausted. Each attempt gets a context which is
+// cancelled after timeout. fn must check it before using a shared bus so an abandoned attempt does not
+// keep the bus busy for the next attempt.
+func Retry[T any](ctx context.Context, retries int, timeout time.Duration, fn func(ctx context.Context) (T, error)) (T, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	type result struct {
+		v   T
+		err error
+	}
+	var zero T
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		ch := make(chan result, 1)
+		go func() {
+			v, err := fn(attemptCtx)
+			ch <- result{v, err}
+		}()
+
+		select {
+		case r := <-ch:
+			cancel()
+			if r.err == nil {
+				return r.v, nil
+			}
+			err = r.err
+		case <-attemptCtx.Done():
+			cancel()
+			if ctx.Err() != nil {
+				return zero, ctx.Err()
+			}
+			err = fmt.Errorf("timeout after %s", timeout)
+		}
+	}
+	return zero, err
+}
@@ -0,0 +1,119 @@
+package meterpoll
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTracker(now *time.Time) *Tracker {
+	t := NewTracker()
+	t.now = func() time.Time { return *now }
+	return t
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newTestTracker(&now)
+	m := config.Meter{InterfaceType: "mbus", PrimaryID: "1", PollInterval: 60}
+
+	assert.True(t, tracker.Due(m))
+	now = now.Add(30 * time.Second)
+	assert.False(t, tracker.Due(m))
+	now = now.Add(29*time.Second + 500*time.Millisecond) // jitter
+	assert.True(t, tracker.Due(m))
+
+	every := config.Meter{InterfaceType: "mbus", PrimaryID: "2"}
+	assert.True(t, tracker.Due(every))
+	assert.True(t, tracker.Due(every))
+}
+
+func TestHealthAndAlarms(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newTestTracker(&now)
+	ok := config.Meter{InterfaceType: "mbus", PrimaryID: "1", Model: "garo-GNM3D-MBUS"}
+	broken := config.Meter{InterfaceType: "mbus", SecondaryID: "90072114361CC702", Model: "garo-GNM3D-MBUS", SilentAlarm: 60}
+	meters := []config.Meter{ok, broken}
+
+	assert.Empty(t, tracker.Alarms(meters))
+
+	tracker.Due(ok)
+	tracker.Success(ok)
+	tracker.Due(broken)
+	tracker.Failure(broken, fmt.Errorf("timeout"))
+	now = now.Add(30 * time.Second)
+	tracker.Failure(broken, fmt.Errorf("no mbus device"))
+
+	health := tracker.Health(meters)
+	assert.Equal(t, "mbus::1", health[0].Id)
+	assert.Equal(t, now.Add(-30*time.Second), health[0].LastSuccess)
+	assert.Equal(t, 0, health[0].ConsecutiveFailures)
+	assert.Equal(t, "mbus::90072114361CC702", health[1].Id)
+	assert.Equal(t, 2, health[1].ConsecutiveFailures)
+	assert.Equal(t, "no mbus device", health[1].LastError)
+	assert.Equal(t, now, health[1].LastErrorTime)
+	assert.True(t, health[1].LastSuccess.IsZero())
+	assert.Empty(t, tracker.Alarms(meters))
+
+	now = now.Add(31 * time.Second)
+	assert.Equal(t, []string{"meter mbus::90072114361CC702 garo-GNM3D-MBUS silent"}, tracker.Alarms(meters))
+
+	now = now.Add(DefaultSilentAlarm)
+	assert.Len(t, tracker.Alarms(meters), 2)
+
+	tracker.Success(broken)
+	assert.Equal(t, []string{"meter mbus::1 garo-GNM3D-MBUS silent"}, tracker.Alarms(meters))
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	v, err := Retry(context.Background(), 2, time.Second, func(ctx context.Context) (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, fmt.Errorf("error %d", calls)
+		}
+		return 42, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	_, err = Retry(context.Background(), 1, time.Second, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, fmt.Errorf("error %d", calls)
+	})
+	assert.EqualError(t, err, "error 2")
+
+	_, err = Retry(context.Background(), 0, 10*time.Millisecond, func(ctx context.Context) (int, error) {
+		time.Sleep(100 * time.Millisecond)
+		return 1, nil
+	})
+	assert.EqualError(t, err, "timeout after 10ms")
+
+	// the abandoned attempt sees its context cancelled before the next attempt starts
+	var bus sync.Mutex
+	var attempts atomic.Int32
+	abandoned := make(chan error, 1)
+	v, err = Retry(context.Background(), 1, 10*time.Millisecond, func(ctx context.Context) (int, error) {
+		if attempts.Add(1) == 1 {
+			bus.Lock()
+			defer bus.Unlock()
+			<-ctx.Done()
+			abandoned <- ctx.Err()
+			return 0, ctx.Err()
+		}
+		bus.Lock()
+		defer bus.Unlock()
+		return 2, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+	assert.ErrorIs(t, <-abandoned, context.DeadlineExceeded)
+}
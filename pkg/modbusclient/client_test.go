@@ -1,6 +1,7 @@
 package modbusclient
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -53,3 +54,87 @@ func TestDecode(t *testing.T) {
 	}
 
 }
+
+func TestDecodeEncodeType(t *testing.T) {
+
+	var tests = []struct {
+		name      string
+		dataType  DataType
+		wordOrder WordOrder
+		value     float64
+		data      []byte
+	}{
+		{
+			name:     "uint16",
+			dataType: DataTypeUint16,
+			value:    65508,
+			data:     []byte{0xff, 0xe4},
+		},
+		{
+			name:     "int16 negative",
+			dataType: DataTypeInt16,
+			value:    -28,
+			data:     []byte{0xff, 0xe4},
+		},
+		{
+			name:      "int32 big word order",
+			dataType:  DataTypeInt32,
+			wordOrder: WordOrderBig,
+			value:     514773,
+			data:      []byte{0x00, 0x07, 0xda, 0xd5},
+		},
+		{
+			name:      "int32 little word order",
+			dataType:  DataTypeInt32,
+			wordOrder: WordOrderLittle,
+			value:     514773,
+			data:      []byte{0xda, 0xd5, 0x00, 0x07},
+		},
+		{
+			name:      "uint32 little word order",
+			dataType:  DataTypeUint32,
+			wordOrder: WordOrderLittle,
+			value:     4294967267,
+			data:      []byte{0xff, 0xe3, 0xff, 0xff},
+		},
+		{
+			name:      "float32 big word order",
+			dataType:  DataTypeFloat32,
+			wordOrder: WordOrderBig,
+			value:     21.5,
+			data:      []byte{0x41, 0xac, 0x00, 0x00},
+		},
+		{
+			name:      "float32 little word order",
+			dataType:  DataTypeFloat32,
+			wordOrder: WordOrderLittle,
+			value:     -1.25,
+			data:      []byte{0x00, 0x00, 0xbf, 0xa0},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := DecodeType(tt.data, tt.dataType, tt.wordOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != tt.value {
+				t.Errorf("DecodeType(%#v): expected %v, actual %v", tt.data, tt.value, actual)
+			}
+
+			data, err := EncodeType(tt.value, tt.dataType, tt.wordOrder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("EncodeType(%v): expected %#v, actual %#v", tt.value, tt.data, data)
+			}
+		})
+	}
+
+	_, err := EncodeType(-1, DataTypeUint16, WordOrderBig)
+	if err == nil {
+		t.Error("expected out of range error")
+	}
+}
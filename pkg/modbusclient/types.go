@@ -0,0 +1,111 @@
+package modbusclient
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+type DataType string
+
+const (
+	DataTypeUint16  DataType = "uint16"
+	DataTypeInt16   DataType = "int16"
+	DataTypeUint32  DataType = "uint32"
+	DataTypeInt32   DataType = "int32"
+	DataTypeFloat32 DataType = "float32"
+)
+
+// WordOrder is the order of the 16 bit registers in 32 bit values. Bytes within a register are always big endian.
+type WordOrder string
+
+const (
+	WordOrderBig    WordOrder = "big"    // high word first
+	WordOrderLittle WordOrder = "little" // low word first
+)
+
+// Registers returns how many 16 bit registers the type occupies.
+func (t DataType) Registers() uint16 {
+	switch t {
+	case DataTypeUint32, DataTypeInt32, DataTypeFloat32:
+		return 2
+	}
+	return 1
+}
+
+func (t DataType) valid() bool {
+	switch t {
+	case DataTypeUint16, DataTypeInt16, DataTypeUint32, DataTypeInt32, DataTypeFloat32:
+		return true
+	}
+	return false
+}
+
+func swapWords(b []byte) []byte {
+	return []byte{b[2], b[3], b[0], b[1]}
+}
+
+// DecodeType decodes register data as data type t.
+func DecodeType(data []byte, t DataType, order WordOrder) (float64, error) {
+	if !t.valid() {
+		return 0, fmt.Errorf("unknown data type %s", t)
+	}
+	size := int(t.Registers()) * 2
+	if len(data) < size {
+		return 0, fmt.Errorf("expected %d bytes for %s got %d", size, t, len(data))
+	}
+	data = data[:size]
+	if size == 4 && order == WordOrderLittle {
+		data = swapWords(data)
+	}
+
+	switch t {
+	case DataTypeUint16:
+		return float64(binary.BigEndian.Uint16(data)), nil
+	case DataTypeInt16:
+		return float64(int16(binary.BigEndian.Uint16(data))), nil
+	case DataTypeUint32:
+		return float64(binary.BigEndian.Uint32(data)), nil
+	case DataTypeInt32:
+		return float64(int32(binary.BigEndian.Uint32(data))), nil
+	default: // DataTypeFloat32
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	}
+}
+
+// EncodeType encodes v as data type t ready to be written to registers.
+func EncodeType(v float64, t DataType, order WordOrder) ([]byte, error) {
+	if !t.valid() {
+		return nil, fmt.Errorf("unknown data type %s", t)
+	}
+	data := make([]byte, t.Registers()*2)
+	switch t {
+	case DataTypeUint16:
+		if v < 0 || v > math.MaxUint16 {
+			return nil, fmt.Errorf("value %v out of range for %s", v, t)
+		}
+		binary.BigEndian.PutUint16(data, uint16(v))
+	case DataTypeInt16:
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			return nil, fmt.Errorf("value %v out of range for %s", v, t)
+		}
+		binary.BigEndian.PutUint16(data, uint16(int16(v)))
+	case DataTypeUint32:
+		if v < 0 || v > math.MaxUint32 {
+			return nil, fmt.Errorf("value %v out of range for %s", v, t)
+		}
+		binary.BigEndian.PutUint32(data, uint32(v))
+	case DataTypeInt32:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("value %v out of range for %s", v, t)
+		}
+		binary.BigEndian.PutUint32(data, uint32(int32(v)))
+	case DataTypeFloat32:
+		binary.BigEndian.PutUint32(data, math.Float32bits(float32(v)))
+	}
+
+	if len(data) == 4 && order == WordOrderLittle {
+		data = swapWords(data)
+	}
+	return data, nil
+}
@@ -0,0 +1,135 @@
+package mqtt
+
+import (
+	"strings"
+
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/sirupsen/logrus"
+)
+
+// TopicPrefix is the topic prefix a meter is allowed to publish to. Defaults to the model for meters
+// without configured topics. Example p1ib.
+func TopicPrefix(m config.Meter) string {
+	if m.TopicPrefix != "" {
+		return m.TopicPrefix
+	}
+	if m.Model == GenericModel || m.Model == RoomSensorModel {
+		return ""
+	}
+	return m.Model
+}
+
+// TopicPrefixes returns the topic prefix of each mqtt meter keyed on Identifier. A meter using the same
+// prefix as an earlier meter is left out since they could publish each other's readings.
+func TopicPrefixes(meters []config.Meter) map[string]string {
+	prefixes := make(map[string]string)
+	owners := make(map[string]config.Meter)
+	for _, m := range meters {
+		prefix := TopicPrefix(m)
+		if m.InterfaceType != "mqtt" || prefix == "" {
+			continue
+		}
+		if owner, ok := owners[prefix]; ok {
+			logrus.Warnf("mqtt meter %s uses topic prefix %s already used by %s. configure a unique topic prefix", m.Identifier(), prefix, owner.Identifier())
+			continue
+		}
+		owners[prefix] = m
+		prefixes[m.Identifier()] = prefix
+	}
+	return prefixes
+}
+
+// User is a local client, for example home automation, allowed to read topics under the Read prefixes
+// and publish under the Write prefixes.
+type User struct {
+	Username string
+	Password string
+	Read     []string
+	Write    []string
+}
+
+// NewLedger creates auth rules where each mqtt meter can connect with its username and password
+// and only use topics under its own prefix and its configured topics. Clients without credentials are rejected.
+// Credentials are matched exactly. Usernames with wildcards and duplicate usernames are rejected since
+// ACL rules match usernames as patterns.
+func NewLedger(meters []config.Meter, users ...User) *auth.Ledger {
+	ledger := &auth.Ledger{
+		Users: auth.Users{},
+		Auth:  auth.AuthRules{},
+		ACL:   auth.ACLRules{},
+	}
+	addUser := func(username, password string, filters auth.Filters) bool {
+		if username == "" || password == "" {
+			return false
+		}
+		if strings.Contains(username, "*") {
+			logrus.Warnf("mqtt username %s must not contain *", username)
+			return false
+		}
+		if _, ok := ledger.Users[username]; ok {
+			logrus.Warnf("mqtt username %s is used more than once", username)
+			return false
+		}
+		ledger.Users[username] = auth.UserRule{
+			Username: auth.RString(username),
+			Password: auth.RString(password),
+		}
+		ledger.ACL = append(ledger.ACL, auth.ACLRule{
+			Username: auth.RString(username),
+			Filters:  filters,
+		})
+		return true
+	}
+
+	prefixes := TopicPrefixes(meters)
+	for _, m := range meters {
+		if m.InterfaceType != "mqtt" {
+			continue
+		}
+		if m.Username == "" || m.Password == "" {
+			logrus.Warnf("mqtt meter %s %s has no username or password and will not be able to connect", m.Model, m.PrimaryID)
+			continue
+		}
+		filters := auth.Filters{}
+		if prefix, ok := prefixes[m.Identifier()]; ok {
+			filters[auth.RString(prefix+"/#")] = auth.ReadWrite
+		} else if TopicPrefix(m) != "" {
+			continue // the prefix belongs to another meter
+		}
+		for _, topic := range meterTopics(m) {
+			filters[auth.RString(topic)] = auth.ReadWrite
+		}
+		addUser(m.Username, m.Password, filters)
+	}
+
+	for _, u := range users {
+		filters := auth.Filters{}
+		for _, prefix := range u.Read {
+			filters[auth.RString(prefix+"/#")] = auth.ReadOnly
+		}
+		for _, prefix := range u.Write {
+			filters[auth.RString(prefix+"/#")] = auth.ReadWrite
+		}
+		if !addUser(u.Username, u.Password, filters) && u.Password == "" {
+			logrus.Warnf("mqtt user %s has no password and will not be able to connect", u.Username)
+		}
+	}
+
+	// deny everything not allowed above. Rules without username matches every client.
+	ledger.ACL = append(ledger.ACL, auth.ACLRule{
+		Filters: auth.Filters{
+			"#": auth.Deny,
+		},
+	})
+	return ledger
+}
+
+// UpdateLedger replaces the users and rules of l with those in from. auth.Ledger.Update does not copy the users.
+func UpdateLedger(l, from *auth.Ledger) {
+	l.Lock()
+	defer l.Unlock()
+	l.Users = from.Users
+	l.Auth = from.Auth
+	l.ACL = from.ACL
+}
@@ -0,0 +1,141 @@
+package mqtt
+
+import (
+	"testing"
+
+	mqttv2 "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func client(username string) *mqttv2.Client {
+	return &mqttv2.Client{
+		ID:         "client-" + username,
+		Properties: mqttv2.ClientProperties{Username: []byte(username)},
+	}
+}
+
+func connect(password string) packets.Packet {
+	return packets.Packet{Connect: packets.ConnectParams{Password: []byte(password)}}
+}
+
+func TestLedger(t *testing.T) {
+	ledger := NewLedger([]config.Meter{
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "1", Username: "p1ib", Password: "secret"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "2", Username: "garage", Password: "secret2", TopicPrefix: "garage/p1ib"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "3", Username: "nopassword", TopicPrefix: "nopassword"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "4", Username: "neighbour", Password: "secret4"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "5", Username: "p1*", Password: "secret5", TopicPrefix: "wildcard"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "6", Username: "pattern", Password: "abc*", TopicPrefix: "pattern"},
+		{InterfaceType: "mbus", Model: "garo-GNM3D-MBUS", Username: "mbus", Password: "secret"},
+		{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "7", Username: "tasmota", Password: "secret3", Topic: "tele/tasmota_1/SENSOR",
+			Fields: []config.FieldMapping{{Path: "ENERGY.Power", Field: "w"}}},
+		{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "8", Username: "tasmota2", Password: "secret6", Topic: "tele/tasmota_2/SENSOR",
+			Fields: []config.FieldMapping{{Path: "ENERGY.Power", Field: "w"}}},
+	})
+
+	tests := []struct {
+		username string
+		password string
+		ok       bool
+	}{
+		{"p1ib", "secret", true},
+		{"p1ib", "wrong", false},
+		{"p1ib", "", false},
+		{"garage", "secret2", true},
+		{"garage", "secret", false},
+		{"nopassword", "", false},
+		{"nopassword", "x", false},
+		{"neighbour", "secret4", false}, // same topic prefix as p1ib
+		{"p1*", "secret5", false},
+		{"p1ib", "secret5", false},
+		{"pattern", "abc*", true},
+		{"pattern", "abcdef", false},
+		{"mbus", "secret", false},
+		{"tasmota2", "secret6", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		_, ok := ledger.AuthOk(client(tt.username), connect(tt.password))
+		assert.Equal(t, tt.ok, ok, "auth %s/%s", tt.username, tt.password)
+	}
+
+	acls := []struct {
+		username string
+		topic    string
+		write    bool
+		ok       bool
+	}{
+		{"p1ib", "p1ib/sensor_state", true, true},
+		{"p1ib", "p1ib/sensor_state", false, true},
+		{"p1ib", "garage/p1ib/sensor_state", true, false},
+		{"p1ib", "other", true, false},
+		{"garage", "garage/p1ib/sensor_state", true, true},
+		{"garage", "p1ib/sensor_state", true, false},
+		{"garage", "p1ib/sensor_state", false, false},
+		{"unknown", "p1ib/sensor_state", true, false},
+		{"tasmota", "tele/tasmota_1/SENSOR", true, true},
+		{"tasmota", "generic/status", true, false},
+		{"tasmota", "tele/tasmota_2/SENSOR", true, false},
+		{"tasmota2", "tele/tasmota_2/SENSOR", true, true},
+		{"neighbour", "p1ib/sensor_state", true, false},
+	}
+	for _, tt := range acls {
+		_, ok := ledger.ACLOk(client(tt.username), tt.topic, tt.write)
+		assert.Equal(t, tt.ok, ok, "acl %s %s write: %t", tt.username, tt.topic, tt.write)
+	}
+}
+
+func TestTopicPrefix(t *testing.T) {
+	assert.Equal(t, "p1ib", TopicPrefix(config.Meter{Model: "p1ib"}))
+	assert.Equal(t, "house/p1ib", TopicPrefix(config.Meter{Model: "p1ib", TopicPrefix: "house/p1ib"}))
+	assert.Equal(t, "", TopicPrefix(config.Meter{Model: GenericModel}))
+}
+
+func TestTopicPrefixes(t *testing.T) {
+	prefixes := TopicPrefixes([]config.Meter{
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "1"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "2"},
+		{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "3", TopicPrefix: "garage/p1ib"},
+		{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "4", Topic: "tele/tasmota_1/SENSOR"},
+		{InterfaceType: "mbus", Model: "p1ib", PrimaryID: "5"},
+	})
+	assert.Equal(t, map[string]string{
+		"mqtt::1": "p1ib",
+		"mqtt::3": "garage/p1ib",
+	}, prefixes)
+}
+
+func TestLedgerUser(t *testing.T) {
+	ledger := NewLedger(nil, User{Username: "homeassistant", Password: "secret", Read: []string{"nergy", "homeassistant"}, Write: []string{"nergy/set"}})
+
+	_, ok := ledger.AuthOk(client("homeassistant"), connect("secret"))
+	assert.True(t, ok)
+	_, ok = ledger.AuthOk(client("homeassistant"), connect("wrong"))
+	assert.False(t, ok)
+
+	_, ok = ledger.ACLOk(client("homeassistant"), "nergy/state/outdoor", false)
+	assert.True(t, ok)
+	_, ok = ledger.ACLOk(client("homeassistant"), "nergy/state/outdoor", true)
+	assert.False(t, ok)
+	_, ok = ledger.ACLOk(client("homeassistant"), "nergy/set/heating", true)
+	assert.True(t, ok)
+	_, ok = ledger.ACLOk(client("homeassistant"), "homeassistant/sensor/x/outdoor/config", false)
+	assert.True(t, ok)
+	_, ok = ledger.ACLOk(client("homeassistant"), "p1ib/sensor_state", false)
+	assert.False(t, ok)
+
+	ledger = NewLedger(nil, User{Username: "homeassistant", Read: []string{"nergy"}})
+	_, ok = ledger.AuthOk(client("homeassistant"), connect(""))
+	assert.False(t, ok)
+	_, ok = ledger.AuthOk(client("homeassistant"), connect("anything"))
+	assert.False(t, ok)
+}
+
+func TestUpdateLedger(t *testing.T) {
+	ledger := NewLedger(nil)
+	UpdateLedger(ledger, NewLedger(nil, User{Username: "homeassistant", Password: "secret", Read: []string{"nergy"}}))
+	_, ok := ledger.AuthOk(client("homeassistant"), connect("secret"))
+	assert.True(t, ok)
+}
@@ -0,0 +1,41 @@
+package mqtt
+
+import (
+	mqttv2 "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Handler receives messages on subscribed topics.
+type Handler func(topic string, payload []byte)
+
+// Broker is the embedded broker or a client connected to an external broker.
+type Broker interface {
+	// Subscribe replaces any previous handler for filter.
+	Subscribe(filter string, handler Handler) error
+	Unsubscribe(filter string) error
+	Publish(topic string, payload []byte, retain bool) error
+	Close() error
+}
+
+// embedded uses the inline client of the embedded broker.
+type embedded struct {
+	server *mqttv2.Server
+}
+
+func (e *embedded) Subscribe(filter string, handler Handler) error {
+	return e.server.Subscribe(filter, 1, func(cl *mqttv2.Client, sub packets.Subscription, pk packets.Packet) {
+		handler(pk.TopicName, pk.Payload)
+	})
+}
+
+func (e *embedded) Unsubscribe(filter string) error {
+	return e.server.Unsubscribe(filter, 1)
+}
+
+func (e *embedded) Publish(topic string, payload []byte, retain bool) error {
+	return e.server.Publish(topic, payload, retain, 0)
+}
+
+func (e *embedded) Close() error {
+	return e.server.Close()
+}
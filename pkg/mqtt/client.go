@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+// ClientOptions configures the connection to an external broker.
+type ClientOptions struct {
+	Broker   string // example tcp://mosquitto:1883, ssl://broker:8883 or wss://broker/mqtt
+	ClientID string
+	Username string
+	Password string
+	CA       string // file with CA certificates for TLS. empty means system roots
+}
+
+// external is connected to an external broker. It reconnects and subscribes again when the connection is lost.
+type external struct {
+	client paho.Client
+
+	handlers map[string]Handler
+	mutex    sync.Mutex
+}
+
+// Connect connects to an external broker instead of starting the embedded one.
+// It does not wait for the connection so the controller can start while the broker is down.
+func Connect(ctx context.Context, wg *sync.WaitGroup, opts ClientOptions) (Broker, error) {
+	c := &external{
+		handlers: make(map[string]Handler),
+	}
+
+	o := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logrus.Errorf("lost connection to mqtt broker %s: %s", opts.Broker, err)
+		})
+	if opts.CA != "" {
+		pem, err := os.ReadFile(opts.CA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading mqtt broker CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CA)
+		}
+		o.SetTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	}
+
+	c.client = paho.NewClient(o)
+	c.client.Connect()
+
+	wg.Add(1)
+	go func() {
+		<-ctx.Done()
+		c.Close()
+		wg.Done()
+	}()
+	return c, nil
+}
+
+// onConnect subscribes to all filters again since the session is not persisted by the broker.
+func (c *external) onConnect(pc paho.Client) {
+	logrus.Info("connected to mqtt broker")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for filter, handler := range c.handlers {
+		if err := c.subscribe(filter, handler); err != nil {
+			logrus.Errorf("error subscribing to %s: %s", filter, err)
+		}
+	}
+}
+
+func (c *external) subscribe(filter string, handler Handler) error {
+	token := c.client.Subscribe(filter, 1, func(_ paho.Client, msg paho.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timeout subscribing to %s", filter)
+	}
+	return token.Error()
+}
+
+func (c *external) Subscribe(filter string, handler Handler) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers[filter] = handler
+	if !c.client.IsConnectionOpen() {
+		return nil // subscribed in onConnect
+	}
+	return c.subscribe(filter, handler)
+}
+
+func (c *external) Unsubscribe(filter string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.handlers, filter)
+	if !c.client.IsConnectionOpen() {
+		return nil
+	}
+	token := c.client.Unsubscribe(filter)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timeout unsubscribing from %s", filter)
+	}
+	return token.Error()
+}
+
+func (c *external) Publish(topic string, payload []byte, retain bool) error {
+	if !c.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to mqtt broker")
+	}
+	token := c.client.Publish(topic, 0, retain, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timeout publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+func (c *external) Close() error {
+	c.client.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	ledger := NewLedger([]config.Meter{
+		{InterfaceType: "mqtt", Model: "p1ib", Username: "nergy", Password: "secret", TopicPrefix: "nergy"},
+	})
+	server, err := Start(ctx, wg, ledger, Options{Address: "127.0.0.1:18886"})
+	assert.NoError(t, err)
+
+	client, err := Connect(ctx, wg, ClientOptions{
+		Broker:   "tcp://127.0.0.1:18886",
+		ClientID: "test",
+		Username: "nergy",
+		Password: "secret",
+	})
+	assert.NoError(t, err)
+
+	received := make(chan string, 1)
+	err = client.Subscribe("nergy/set/+", func(topic string, payload []byte) {
+		received <- topic + " " + string(payload)
+	})
+	assert.NoError(t, err)
+
+	waitFor(t, "client connected", func() bool {
+		return client.Publish("nergy/state/outdoor", []byte("2.5"), true) == nil
+	})
+	retained := make(chan string, 1)
+	err = server.Subscribe("nergy/state/#", func(topic string, payload []byte) {
+		retained <- topic + " " + string(payload)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "nergy/state/outdoor 2.5", <-retained)
+
+	err = server.Publish("nergy/set/heating", []byte("2h"), false)
+	assert.NoError(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, "nergy/set/heating 2h", msg)
+	case <-time.After(5 * time.Second):
+		t.Error("timeout waiting for message from broker")
+	}
+}
+
+func waitFor(t *testing.T, msg string, ok func() bool) {
+	end := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(end) {
+			t.Fatalf("timeout waiting for: %s", msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,208 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+)
+
+// GenericModel is the model of mqtt meters configured with a topic and field mapping.
+const GenericModel = "generic"
+
+// meterFields is the json names of the values in meter.Data.
+var meterFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	for _, f := range jsonFields(reflect.TypeOf(meter.Data{})) {
+		if f.kind == reflect.Float64 {
+			fields[f.name] = true
+		}
+	}
+	return fields
+}()
+
+// GenericMeter converts json or plain number payloads to meter data using the field mapping of the meter.
+// Fields can be mapped from different topics so each value keeps the time it was received.
+type GenericMeter struct {
+	meter  config.Meter
+	maxAge time.Duration
+
+	values map[string]sample
+	time   time.Time
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+func NewGenericMeter(m config.Meter) (*GenericMeter, error) {
+	if len(m.Fields) == 0 {
+		return nil, fmt.Errorf("mqtt meter %s has no fields", m.Identifier())
+	}
+	for _, f := range m.Fields {
+		if !meterFields[f.Field] {
+			return nil, fmt.Errorf("mqtt meter %s has unknown field %s", m.Identifier(), f.Field)
+		}
+		if f.Topic == "" && m.Topic == "" {
+			return nil, fmt.Errorf("mqtt meter %s has no topic for field %s", m.Identifier(), f.Field)
+		}
+	}
+	return &GenericMeter{
+		meter:  m,
+		maxAge: MaxAge(m),
+		values: make(map[string]sample),
+		now:    time.Now,
+	}, nil
+}
+
+// Topics returns all topics the meter publishes to.
+func (g *GenericMeter) Topics() []string {
+	return genericTopics(g.meter)
+}
+
+// meterTopics returns the topics an mqtt meter publishes to outside of its topic prefix.
+func meterTopics(m config.Meter) []string {
+	switch m.Model {
+	case GenericModel:
+		return genericTopics(m)
+	case RoomSensorModel:
+		return []string{roomSensorField(m).Topic}
+	}
+	return nil
+}
+
+func genericTopics(m config.Meter) []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, f := range m.Fields {
+		topic := f.Topic
+		if topic == "" {
+			topic = m.Topic
+		}
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// Handle updates the values mapped from topic with payload.
+func (g *GenericMeter) Handle(topic string, payload []byte) error {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		doc = strings.TrimSpace(string(payload)) // plain values like ESPHome states
+	}
+
+	values := make(map[string]float64)
+	for _, f := range g.meter.Fields {
+		if f.Topic != topic && (f.Topic != "" || g.meter.Topic != topic) {
+			continue
+		}
+		v, err := lookup(doc, f.Path)
+		if err != nil {
+			return fmt.Errorf("error mapping %s from %s: %w", f.Field, topic, err)
+		}
+		if f.Scale != 0 {
+			v *= f.Scale
+		}
+		values[f.Field] = v
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.time = g.now()
+	for field, v := range values {
+		g.values[field] = sample{value: v, time: g.time}
+	}
+	return nil
+}
+
+// LastReceived is zero if nothing has been received.
+func (g *GenericMeter) LastReceived() time.Time {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.time
+}
+
+// Data returns the latest values or nil if nothing has been received. Values older than the max age
+// of the meter are left out. Time is when the newest value was received.
+func (g *GenericMeter) Data() (*meter.Data, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.time.IsZero() {
+		return nil, nil
+	}
+	values := make(map[string]float64)
+	for field, s := range g.values {
+		if g.now().Sub(s.time) <= g.maxAge {
+			values[field] = s.value
+		}
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	data := &meter.Data{}
+	err = json.Unmarshal(b, data)
+	if err != nil {
+		return nil, err
+	}
+	data.Id = g.meter.PrimaryID
+	data.Model = g.meter.Model
+	data.Time = g.time
+	return data, nil
+}
+
+// lookup finds the number at the dot separated path. Numbers in arrays are indexes.
+func lookup(doc any, path string) (float64, error) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch v := doc.(type) {
+			case map[string]any:
+				var ok bool
+				doc, ok = v[key]
+				if !ok {
+					return 0, fmt.Errorf("path %s not found", path)
+				}
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(v) {
+					return 0, fmt.Errorf("path %s not found", path)
+				}
+				doc = v[i]
+			default:
+				return 0, fmt.Errorf("path %s not found", path)
+			}
+		}
+	}
+
+	switch v := doc.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value at %s is not a number: %s", path, v)
+		}
+		return f, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("value at %s is not a number", path)
+}
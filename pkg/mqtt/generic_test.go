@@ -0,0 +1,125 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericMeter(t *testing.T) {
+	tests := []struct {
+		name     string
+		meter    config.Meter
+		messages map[string]string
+		expected map[string]float64
+	}{
+		{
+			name: "tasmota",
+			meter: config.Meter{Topic: "tele/tasmota_1/SENSOR", Fields: []config.FieldMapping{
+				{Path: "ENERGY.Power", Field: "w"},
+				{Path: "ENERGY.Total", Field: "wh", Scale: 1000},
+				{Path: "ENERGY.Voltage", Field: "l1_v"},
+			}},
+			messages: map[string]string{
+				"tele/tasmota_1/SENSOR": `{"Time":"2024-01-01T12:00:00","ENERGY":{"Total":12.345,"Power":150,"Voltage":231,"Current":0.65}}`,
+			},
+			expected: map[string]float64{"w": 150, "wh": 12345, "l1_v": 231},
+		},
+		{
+			name: "shelly",
+			meter: config.Meter{Topic: "shellies/em3/status", Fields: []config.FieldMapping{
+				{Path: "emeters.0.power", Field: "w"},
+				{Path: "emeters.1.current", Field: "l2_a"},
+			}},
+			messages: map[string]string{
+				"shellies/em3/status": `{"emeters":[{"power":1200.5,"current":5.2},{"power":10,"current":"0.5"}]}`,
+			},
+			expected: map[string]float64{"w": 1200.5, "l2_a": 0.5},
+		},
+		{
+			name: "esphome",
+			meter: config.Meter{Fields: []config.FieldMapping{
+				{Topic: "esphome/sensor/power/state", Field: "w", Scale: 1000},
+				{Topic: "esphome/sensor/energy/state", Field: "wh"},
+			}},
+			messages: map[string]string{
+				"esphome/sensor/power/state":  "1.5",
+				"esphome/sensor/energy/state": "  4242 ",
+			},
+			expected: map[string]float64{"w": 1500, "wh": 4242},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.meter.InterfaceType = "mqtt"
+			tt.meter.Model = GenericModel
+			tt.meter.PrimaryID = "1"
+			g, err := NewGenericMeter(tt.meter)
+			assert.NoError(t, err)
+
+			data, err := g.Data()
+			assert.NoError(t, err)
+			assert.Nil(t, data)
+
+			for topic, payload := range tt.messages {
+				assert.NoError(t, g.Handle(topic, []byte(payload)))
+			}
+			data, err = g.Data()
+			assert.NoError(t, err)
+			assert.Equal(t, "1", data.Id)
+			assert.Equal(t, GenericModel, data.Model)
+			assert.False(t, data.Time.IsZero())
+
+			values := map[string]float64{
+				"w": data.Current_W, "wh": data.Total_WH, "l1_v": data.L1_V, "l2_a": data.L2_A,
+			}
+			for field, v := range values {
+				assert.Equal(t, tt.expected[field], v, field)
+			}
+		})
+	}
+}
+
+func TestGenericMeterStaleFields(t *testing.T) {
+	g, err := NewGenericMeter(config.Meter{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "1", MaxAge: 60, Fields: []config.FieldMapping{
+		{Topic: "esphome/sensor/power/state", Field: "w"},
+		{Topic: "esphome/sensor/energy/state", Field: "wh"},
+	}})
+	assert.NoError(t, err)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	assert.NoError(t, g.Handle("esphome/sensor/energy/state", []byte("4242")))
+	now = now.Add(50 * time.Second)
+	assert.NoError(t, g.Handle("esphome/sensor/power/state", []byte("1500")))
+
+	data, err := g.Data()
+	assert.NoError(t, err)
+	assert.Equal(t, 1500.0, data.Current_W)
+	assert.Equal(t, 4242.0, data.Total_WH)
+
+	now = now.Add(20 * time.Second) // energy is 70s old
+	data, err = g.Data()
+	assert.NoError(t, err)
+	assert.Equal(t, 1500.0, data.Current_W)
+	assert.Equal(t, 0.0, data.Total_WH)
+	assert.Equal(t, now.Add(-20*time.Second), data.Time)
+}
+
+func TestGenericMeterErrors(t *testing.T) {
+	_, err := NewGenericMeter(config.Meter{Topic: "a", Fields: []config.FieldMapping{{Field: "watts"}}})
+	assert.ErrorContains(t, err, "unknown field watts")
+	_, err = NewGenericMeter(config.Meter{Fields: []config.FieldMapping{{Field: "w"}}})
+	assert.ErrorContains(t, err, "no topic")
+	_, err = NewGenericMeter(config.Meter{Topic: "a"})
+	assert.ErrorContains(t, err, "no fields")
+
+	g, err := NewGenericMeter(config.Meter{Topic: "a", Fields: []config.FieldMapping{{Path: "power", Field: "w"}}})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, g.Handle("a", []byte(`{"energy":1}`)), "path power not found")
+	assert.ErrorContains(t, g.Handle("a", []byte(`{"power":"ON"}`)), "not a number")
+	assert.NoError(t, g.Handle("other", []byte(`{}`)))
+}
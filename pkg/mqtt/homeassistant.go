@@ -0,0 +1,287 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/nergy-se/controller/pkg/state"
+)
+
+// HomeAssistant configures Home Assistant MQTT discovery.
+type HomeAssistant struct {
+	DiscoveryPrefix string // usually homeassistant
+	ID              string // unique id of the controller. example the serial number
+}
+
+type entity struct {
+	name        string
+	component   string // sensor or binary_sensor. sensor if empty
+	deviceClass string
+	unit        string
+	stateClass  string
+}
+
+func temperature(name string) entity {
+	return entity{name: name, deviceClass: "temperature", unit: "°C", stateClass: "measurement"}
+}
+
+func percent(name string) entity {
+	return entity{name: name, unit: "%", stateClass: "measurement"}
+}
+
+func pressure(name string) entity {
+	return entity{name: name, deviceClass: "pressure", unit: "bar", stateClass: "measurement"}
+}
+
+func binary(name, deviceClass string) entity {
+	return entity{name: name, component: "binary_sensor", deviceClass: deviceClass}
+}
+
+// stateEntities is keyed by json name in state.State. Fields not listed here get defaults from their type.
+var stateEntities = map[string]entity{
+	"time":                     {name: "Last update", deviceClass: "timestamp"},
+	"indoorMin":                temperature("Indoor min"),
+	"indoor":                   temperature("Indoor"),
+	"indoorMax":                temperature("Indoor max"),
+	"indoorSetpoint":           temperature("Indoor setpoint"),
+	"outdoor":                  temperature("Outdoor"),
+	"heatCarrierForward":       temperature("Heat carrier forward"),
+	"heatCarrierReturn":        temperature("Heat carrier return"),
+	"radiatorForward":          temperature("Radiator forward"),
+	"radiatorReturn":           temperature("Radiator return"),
+	"brineIn":                  temperature("Brine in"),
+	"brineOut":                 temperature("Brine out"),
+	"hotGasCompressor":         temperature("Hot gas compressor"),
+	"warmWater":                temperature("Hot water"),
+	"superHeatTemperature":     temperature("Superheat"),
+	"suctionGasTemperature":    temperature("Suction gas"),
+	"compressor":               percent("Compressor"),
+	"pumpBrine":                percent("Brine pump"),
+	"pumpHeat":                 percent("Heat carrier pump"),
+	"pumpRadiator":             percent("Radiator pump"),
+	"lowPressureSidePressure":  pressure("Low pressure side"),
+	"highPressureSidePressure": pressure("High pressure side"),
+	"cop":                      {name: "COP", stateClass: "measurement"},
+	"alarm":                    binary("Alarm", "problem"),
+	"switchValve":              binary("Switch valve hot water", ""),
+	"heatingAllowed":           binary("Heating allowed", ""),
+	"hotwaterAllowed":          binary("Hot water allowed", ""),
+	"queueDepth":               {name: "Upload queue", stateClass: "measurement"},
+}
+
+var scheduleEntities = map[string]entity{
+	"time":          {name: "Schedule period", deviceClass: "timestamp"},
+	"price":         {name: "Price", stateClass: "measurement"},
+	"heating":       binary("Scheduled heating", ""),
+	"hotwater":      binary("Scheduled hot water", ""),
+	"hotwaterForce": binary("Scheduled hot water boost", ""),
+}
+
+// meterEntities is keyed by json name in meter.Data. Other fields are not exposed.
+var meterEntities = map[string]entity{
+	"w":           {name: "Power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"wh":          {name: "Energy", deviceClass: "energy", unit: "Wh", stateClass: "total_increasing"},
+	"import_w":    {name: "Import power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"export_w":    {name: "Export power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"export_wh":   {name: "Export energy", deviceClass: "energy", unit: "Wh", stateClass: "total_increasing"},
+	"l1_w":        {name: "L1 power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"l2_w":        {name: "L2 power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"l3_w":        {name: "L3 power", deviceClass: "power", unit: "W", stateClass: "measurement"},
+	"var":         {name: "Reactive power", deviceClass: "reactive_power", unit: "var", stateClass: "measurement"},
+	"import_varh": {name: "Reactive import energy", unit: "varh", stateClass: "total_increasing"},
+	"export_varh": {name: "Reactive export energy", unit: "varh", stateClass: "total_increasing"},
+	"vll":         {name: "Voltage line to line", deviceClass: "voltage", unit: "V", stateClass: "measurement"},
+	"vln":         {name: "Voltage line to neutral", deviceClass: "voltage", unit: "V", stateClass: "measurement"},
+	"l1_v":        {name: "L1 voltage", deviceClass: "voltage", unit: "V", stateClass: "measurement"},
+	"l2_v":        {name: "L2 voltage", deviceClass: "voltage", unit: "V", stateClass: "measurement"},
+	"l3_v":        {name: "L3 voltage", deviceClass: "voltage", unit: "V", stateClass: "measurement"},
+	"l1_a":        {name: "L1 current", deviceClass: "current", unit: "A", stateClass: "measurement"},
+	"l2_a":        {name: "L2 current", deviceClass: "current", unit: "A", stateClass: "measurement"},
+	"l3_a":        {name: "L3 current", deviceClass: "current", unit: "A", stateClass: "measurement"},
+	"m3":          {name: "Volume", deviceClass: "water", unit: "m³", stateClass: "total_increasing"},
+	"m3h":         {name: "Flow", deviceClass: "volume_flow_rate", unit: "m³/h", stateClass: "measurement"},
+	"supply_c":    temperature("Supply"),
+	"return_c":    temperature("Return"),
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+type haConfig struct {
+	Name          string   `json:"name"`
+	UniqueID      string   `json:"unique_id"`
+	StateTopic    string   `json:"state_topic"`
+	ValueTemplate string   `json:"value_template,omitempty"`
+	DeviceClass   string   `json:"device_class,omitempty"`
+	StateClass    string   `json:"state_class,omitempty"`
+	Unit          string   `json:"unit_of_measurement,omitempty"`
+	PayloadOn     string   `json:"payload_on,omitempty"`
+	PayloadOff    string   `json:"payload_off,omitempty"`
+	Device        haDevice `json:"device"`
+}
+
+var invalidObjectID = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// objectID makes s usable in topics and Home Assistant ids.
+func objectID(s string) string {
+	return invalidObjectID.ReplaceAllString(s, "_")
+}
+
+func (p *Publisher) nodeID() string {
+	return objectID(p.ha.ID)
+}
+
+func (p *Publisher) controllerDevice() haDevice {
+	return haDevice{
+		Identifiers:  []string{p.nodeID()},
+		Name:         "Nergy controller",
+		Manufacturer: "Nergy",
+	}
+}
+
+// publishEntity publishes the discovery config for one entity with object id id.
+func (p *Publisher) publishEntity(id string, e entity, stateTopic, valueTemplate string, device haDevice) error {
+	component := e.component
+	if component == "" {
+		component = "sensor"
+	}
+	c := haConfig{
+		Name:          e.name,
+		UniqueID:      p.nodeID() + "_" + id,
+		StateTopic:    stateTopic,
+		ValueTemplate: valueTemplate,
+		DeviceClass:   e.deviceClass,
+		StateClass:    e.stateClass,
+		Unit:          e.unit,
+		Device:        device,
+	}
+	if component == "binary_sensor" && valueTemplate == "" {
+		c.PayloadOn = "true"
+		c.PayloadOff = "false"
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	topic := strings.Join([]string{p.ha.DiscoveryPrefix, component, p.nodeID(), id, "config"}, "/")
+	return p.broker.Publish(topic, b, true)
+}
+
+// PublishDiscovery publishes Home Assistant discovery for the controller and the heat pump of type pumpModel.
+// Meters are discovered when their values are published.
+func (p *Publisher) PublishDiscovery(pumpModel string) error {
+	if p.ha == nil {
+		return nil
+	}
+	controller := p.controllerDevice()
+	pump := haDevice{
+		Identifiers:  []string{p.nodeID() + "_heatpump"},
+		Name:         "Heat pump",
+		Model:        pumpModel,
+		Manufacturer: "Nergy",
+		ViaDevice:    p.nodeID(),
+	}
+
+	var errs []error
+	for _, field := range jsonFields(reflect.TypeOf(state.State{})) {
+		e, ok := stateEntities[field.name]
+		if !ok {
+			e = entity{name: field.name, stateClass: "measurement"}
+			if field.kind == reflect.Bool {
+				e = binary(field.name, "")
+			}
+		}
+		errs = append(errs, p.publishEntity("state_"+field.name, e, p.prefix+"/state/"+field.name, "", pump))
+	}
+	for _, field := range jsonFields(reflect.TypeOf(config.HourConfig{})) {
+		e, ok := scheduleEntities[field.name]
+		if !ok {
+			continue
+		}
+		errs = append(errs, p.publishEntity("schedule_"+field.name, e, p.prefix+"/schedule/"+field.name, "", controller))
+	}
+
+	errs = append(errs, p.publishEntity("alarm", binary("Alarm", "problem"), p.prefix+"/alarms",
+		"{{ 'ON' if value_json | length > 0 else 'OFF' }}", controller))
+	errs = append(errs, p.publishEntity("alarms", entity{name: "Alarms"}, p.prefix+"/alarms",
+		"{{ value_json | join(', ') | truncate(255) }}", controller))
+	return errors.Join(errs...)
+}
+
+// publishMeterDiscovery publishes discovery for the values present in data the first time they are seen.
+func (p *Publisher) publishMeterDiscovery(data *meter.Data) error {
+	if p.ha == nil {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage)
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+
+	id := objectID(data.Id)
+	device := haDevice{
+		Identifiers: []string{p.nodeID() + "_meter_" + id},
+		Name:        data.Model + " " + data.Id,
+		Model:       data.Model,
+		ViaDevice:   p.nodeID(),
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var errs []error
+	for name := range fields {
+		e, ok := meterEntities[name]
+		if !ok {
+			continue
+		}
+		objectID := "meter_" + id + "_" + name
+		if p.discovered[objectID] {
+			continue
+		}
+		// meter data omits zero values so a missing field is zero and not unknown.
+		err := p.publishEntity(objectID, e, p.meterTopic(data), "{{ value_json."+name+" | default(0) }}", device)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.discovered[objectID] = true
+	}
+	return errors.Join(errs...)
+}
+
+type jsonField struct {
+	name string
+	kind reflect.Kind // pointers are dereferenced
+}
+
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		fields = append(fields, jsonField{name: name, kind: ft.Kind()})
+	}
+	return fields
+}
@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	mqttv2 "github.com/mochi-mqtt/server/v2"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishDiscovery(t *testing.T) {
+	server := mqttv2.New(&mqttv2.Options{InlineClient: true})
+	defer server.Close()
+	p := NewPublisher(&embedded{server: server}, "nergy", &HomeAssistant{DiscoveryPrefix: "homeassistant", ID: "abc:123"})
+
+	err := p.PublishDiscovery("thermiagenesis")
+	assert.NoError(t, err)
+	messages := retained(t, server, "homeassistant/#")
+
+	c := haConfig{}
+	err = json.Unmarshal([]byte(messages["homeassistant/sensor/abc_123/state_outdoor/config"]), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc_123_state_outdoor", c.UniqueID)
+	assert.Equal(t, "nergy/state/outdoor", c.StateTopic)
+	assert.Equal(t, "temperature", c.DeviceClass)
+	assert.Equal(t, "°C", c.Unit)
+	assert.Equal(t, "thermiagenesis", c.Device.Model)
+	assert.Equal(t, "abc_123", c.Device.ViaDevice)
+
+	c = haConfig{}
+	err = json.Unmarshal([]byte(messages["homeassistant/binary_sensor/abc_123/state_heatingAllowed/config"]), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, "true", c.PayloadOn)
+	assert.Equal(t, "false", c.PayloadOff)
+
+	c = haConfig{}
+	err = json.Unmarshal([]byte(messages["homeassistant/binary_sensor/abc_123/alarm/config"]), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, "problem", c.DeviceClass)
+	assert.Equal(t, "nergy/alarms", c.StateTopic)
+	assert.Equal(t, []string{"abc_123"}, c.Device.Identifiers)
+
+	assert.Contains(t, messages, "homeassistant/sensor/abc_123/schedule_price/config")
+	assert.Contains(t, messages, "homeassistant/binary_sensor/abc_123/schedule_hotwater/config")
+}
+
+func TestPublishMeterDiscovery(t *testing.T) {
+	server := mqttv2.New(&mqttv2.Options{InlineClient: true})
+	defer server.Close()
+	p := NewPublisher(&embedded{server: server}, "nergy", &HomeAssistant{DiscoveryPrefix: "homeassistant", ID: "abc"})
+
+	err := p.PublishMeter(&meter.Data{Id: "12345678", Model: "kamstrup-multical-403", Time: time.Now(), Total_WH: 1000, Flow_M3H: 0.5})
+	assert.NoError(t, err)
+	messages := retained(t, server, "#")
+
+	assert.Contains(t, messages["nergy/meter/12345678"], `"wh":1000`)
+	assert.Len(t, filterPrefix(messages, "homeassistant/"), 2)
+
+	c := haConfig{}
+	err = json.Unmarshal([]byte(messages["homeassistant/sensor/abc/meter_12345678_wh/config"]), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, "energy", c.DeviceClass)
+	assert.Equal(t, "total_increasing", c.StateClass)
+	assert.Equal(t, "{{ value_json.wh | default(0) }}", c.ValueTemplate)
+	assert.Equal(t, "nergy/meter/12345678", c.StateTopic)
+	assert.Equal(t, "kamstrup-multical-403 12345678", c.Device.Name)
+
+	c = haConfig{}
+	err = json.Unmarshal([]byte(messages["homeassistant/sensor/abc/meter_12345678_m3h/config"]), &c)
+	assert.NoError(t, err)
+	assert.Equal(t, "m³/h", c.Unit)
+}
+
+func filterPrefix(messages map[string]string, prefix string) []string {
+	var topics []string
+	for topic := range messages {
+		if strings.HasPrefix(topic, prefix) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
@@ -2,6 +2,7 @@ package mqtt
 
 import (
 	"context"
+	"crypto/tls"
 	"sync"
 
 	mqttv2 "github.com/mochi-mqtt/server/v2"
@@ -9,25 +10,68 @@ import (
 	"github.com/mochi-mqtt/server/v2/listeners"
 )
 
-func Start(ctx context.Context, wg *sync.WaitGroup) (*mqttv2.Server, error) {
-	wg.Add(1)
+// Options configures the listeners. Empty address disables the listener.
+type Options struct {
+	Address          string // plain TCP
+	TLSAddress       string
+	TLSCert          string // a self signed certificate is generated if the file does not exist
+	TLSKey           string
+	WebsocketAddress string // websocket. uses TLS if TLSAddress is set
+}
+
+func newListeners(opts Options) ([]listeners.Listener, error) {
+	var result []listeners.Listener
+	if opts.Address != "" {
+		result = append(result, listeners.NewTCP(listeners.Config{ID: "tcp", Address: opts.Address}))
+	}
+
+	var tlsConfig *tls.Config
+	if opts.TLSAddress != "" {
+		cert, err := loadOrCreateCertificate(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		result = append(result, listeners.NewTCP(listeners.Config{ID: "tls", Address: opts.TLSAddress, TLSConfig: tlsConfig}))
+	}
+
+	if opts.WebsocketAddress != "" {
+		result = append(result, listeners.NewWebsocket(listeners.Config{ID: "ws", Address: opts.WebsocketAddress, TLSConfig: tlsConfig}))
+	}
+	return result, nil
+}
+
+// Start starts the broker. Clients are authenticated with ledger which can be updated while running.
+func Start(ctx context.Context, wg *sync.WaitGroup, ledger *auth.Ledger, opts Options) (Broker, error) {
+	ls, err := newListeners(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	server := mqttv2.New(&mqttv2.Options{
 		InlineClient: true,
 	})
 
-	// Allow all connections.
-	_ = server.AddHook(new(auth.AllowHook), nil)
-
-	// Create a TCP listener on a standard port.
-	tcp := listeners.NewTCP(listeners.Config{ID: "t1", Address: ":1883"})
-	err := server.AddListener(tcp)
+	err = server.AddHook(new(auth.Hook), &auth.Options{
+		Ledger: ledger,
+	})
 	if err != nil {
-		return server, err
+		return nil, err
+	}
+
+	for _, l := range ls {
+		err = server.AddListener(l)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	err = server.Serve()
 	if err != nil {
-		return server, err
+		return nil, err
 	}
 
 	//TODO listen for only this topic
@@ -87,10 +131,11 @@ func Start(ctx context.Context, wg *sync.WaitGroup) (*mqttv2.Server, error) {
 	*/
 
 	// Run server until interrupted
+	wg.Add(1)
 	go func() {
 		<-ctx.Done()
 		server.Close()
 		wg.Done()
 	}()
-	return server, nil
+	return &embedded{server: server}, nil
 }
@@ -0,0 +1,112 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// connectPacket is a MQTT 3.1.1 CONNECT with client id a.
+var connectPacket = []byte{0x10, 0x0d, 0x00, 0x04, 'M', 'Q', 'T', 'T', 0x04, 0x02, 0x00, 0x3c, 0x00, 0x01, 'a'}
+
+// waitRefused sends CONNECT and reads until the broker closes the connection. The ledger without
+// users refuses every client. The broker must be done with its clients before it is closed since
+// mochi does not synchronize closing listeners with clients being set up.
+func waitRefused(t *testing.T, w io.Writer, r io.Reader, packet []byte) {
+	_, err := w.Write(packet)
+	assert.NoError(t, err)
+	_, err = io.Copy(io.Discard, r)
+	assert.NoError(t, err)
+}
+
+func TestStartListeners(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	opts := Options{
+		Address:          "127.0.0.1:18883",
+		TLSAddress:       "127.0.0.1:18884",
+		TLSCert:          filepath.Join(dir, "mqtt.crt"),
+		TLSKey:           filepath.Join(dir, "mqtt.key"),
+		WebsocketAddress: "127.0.0.1:18885",
+	}
+	_, err := Start(ctx, wg, NewLedger(nil), opts)
+	assert.NoError(t, err)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	conn, err := net.Dial("tcp", opts.Address)
+	assert.NoError(t, err)
+	defer conn.Close()
+	waitRefused(t, conn, conn, connectPacket)
+
+	tlsConn, err := tls.Dial("tcp", opts.TLSAddress, &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	defer tlsConn.Close()
+	assert.Equal(t, "localhost", tlsConn.ConnectionState().PeerCertificates[0].DNSNames[1])
+	waitRefused(t, tlsConn, tlsConn, connectPacket)
+
+	wsConn, err := tls.Dial("tcp", opts.WebsocketAddress, &tls.Config{InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	defer wsConn.Close()
+	fmt.Fprintf(wsConn, "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: mqtt\r\n\r\n")
+	r := bufio.NewReader(wsConn)
+	resp, err := http.ReadResponse(r, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// binary frame from the client is masked. a zero mask leaves the payload as is.
+	frame := append([]byte{0x82, 0x80 | byte(len(connectPacket)), 0, 0, 0, 0}, connectPacket...)
+	waitRefused(t, wsConn, r, frame)
+}
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "mqtt.crt")
+	keyFile := filepath.Join(dir, "mqtt.key")
+
+	cert, err := loadOrCreateCertificate(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.FileExists(t, keyFile)
+
+	// second time the same certificate is loaded
+	cert2, err := loadOrCreateCertificate(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, cert.Certificate, cert2.Certificate)
+}
+
+func TestStartAgainAfterStop(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	opts := Options{Address: "127.0.0.1:18887"}
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		broker, err := Start(ctx, wg, NewLedger(nil), opts)
+		assert.NoError(t, err)
+
+		received := make(chan string, 1)
+		err = broker.Subscribe("nergy/#", func(topic string, payload []byte) {
+			received <- string(payload)
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, broker.Publish("nergy/a", []byte("1"), false))
+		assert.Equal(t, "1", <-received)
+
+		assert.NoError(t, broker.Unsubscribe("nergy/#"))
+		assert.NoError(t, broker.Publish("nergy/a", []byte("2"), false))
+		assert.Empty(t, received)
+
+		cancel()
+		wg.Wait()
+	}
+}
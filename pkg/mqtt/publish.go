@@ -0,0 +1,115 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/nergy-se/controller/pkg/override"
+	"github.com/nergy-se/controller/pkg/state"
+)
+
+// Publisher publishes what the controller knows as retained messages for local home automation systems.
+type Publisher struct {
+	broker Broker
+	prefix string
+
+	ha *HomeAssistant
+	// discovered is meter discovery topics already published.
+	discovered map[string]bool
+	mutex      sync.Mutex
+}
+
+// NewPublisher creates a publisher. Home Assistant discovery is disabled if ha is nil.
+func NewPublisher(broker Broker, prefix string, ha *HomeAssistant) *Publisher {
+	return &Publisher{
+		broker:     broker,
+		prefix:     prefix,
+		ha:         ha,
+		discovered: make(map[string]bool),
+	}
+}
+
+// PublishState publishes the whole state as json to prefix/state and each field to prefix/state/<field>.
+func (p *Publisher) PublishState(s *state.State) error {
+	return p.publishFields("state", s)
+}
+
+// PublishSchedule publishes the current hour to prefix/schedule and each field to prefix/schedule/<field>.
+func (p *Publisher) PublishSchedule(h *config.HourConfig) error {
+	return p.publishFields("schedule", h)
+}
+
+// PublishAlarms publishes active alarms as a json list to prefix/alarms.
+func (p *Publisher) PublishAlarms(alarms []string) error {
+	if alarms == nil {
+		alarms = []string{}
+	}
+	b, err := json.Marshal(alarms)
+	if err != nil {
+		return err
+	}
+	return p.broker.Publish(p.prefix+"/alarms", b, true)
+}
+
+// PublishOverrides publishes active local overrides as a json list to prefix/overrides.
+func (p *Publisher) PublishOverrides(overrides []override.Override) error {
+	b, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	return p.broker.Publish(p.prefix+"/overrides", b, true)
+}
+
+// PublishMeter publishes meter data as json to prefix/meter/<id> and Home Assistant discovery for its values.
+func (p *Publisher) PublishMeter(data *meter.Data) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	err = p.broker.Publish(p.meterTopic(data), b, true)
+	if err != nil {
+		return err
+	}
+	return p.publishMeterDiscovery(data)
+}
+
+func (p *Publisher) meterTopic(data *meter.Data) string {
+	return p.prefix + "/meter/" + objectID(data.Id)
+}
+
+func (p *Publisher) publishFields(topic string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = p.broker.Publish(p.prefix+"/"+topic, b, true)
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for name, value := range fields {
+		if string(value) == "null" {
+			continue // home assistant logs an error for null values. the last known value is kept
+		}
+		errs = append(errs, p.broker.Publish(p.prefix+"/"+topic+"/"+name, fieldValue(value), true))
+	}
+	return errors.Join(errs...)
+}
+
+// fieldValue removes the quotes from json strings so all fields are plain values.
+func fieldValue(value json.RawMessage) []byte {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return []byte(s)
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	mqttv2 "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/nergy-se/controller/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func retained(t *testing.T, server *mqttv2.Server, filter string) map[string]string {
+	messages := make(map[string]string)
+	err := server.Subscribe(filter, 1, func(cl *mqttv2.Client, sub packets.Subscription, pk packets.Packet) {
+		messages[pk.TopicName] = string(pk.Payload)
+	})
+	assert.NoError(t, err)
+	return messages
+}
+
+func TestPublisher(t *testing.T) {
+	server := mqttv2.New(&mqttv2.Options{InlineClient: true})
+	defer server.Close()
+	p := NewPublisher(&embedded{server: server}, "nergy", nil)
+
+	outdoor := 2.5
+	alarm := false
+	err := p.PublishState(&state.State{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Outdoor: &outdoor,
+		Alarm:   &alarm,
+	})
+	assert.NoError(t, err)
+	err = p.PublishSchedule(&config.HourConfig{Price: 1.25, Heating: true})
+	assert.NoError(t, err)
+	err = p.PublishAlarms(nil)
+	assert.NoError(t, err)
+
+	messages := retained(t, server, "nergy/#")
+	assert.Equal(t, "2.5", messages["nergy/state/outdoor"])
+	assert.Equal(t, "false", messages["nergy/state/alarm"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", messages["nergy/state/time"])
+	assert.JSONEq(t, `{"time":"2024-01-02T03:04:05Z","outdoor":2.5,"alarm":false}`, messages["nergy/state"])
+	assert.Equal(t, "1.25", messages["nergy/schedule/price"])
+	assert.Equal(t, "true", messages["nergy/schedule/heating"])
+	assert.Equal(t, "false", messages["nergy/schedule/hotwater"])
+	assert.Equal(t, "[]", messages["nergy/alarms"])
+
+	err = p.PublishAlarms([]string{"high pressure"})
+	assert.NoError(t, err)
+	messages = retained(t, server, "nergy/alarms")
+	assert.Equal(t, `["high pressure"]`, messages["nergy/alarms"])
+}
+
+func TestPublishFieldsSkipsNull(t *testing.T) {
+	server := mqttv2.New(&mqttv2.Options{InlineClient: true})
+	defer server.Close()
+	p := NewPublisher(&embedded{server: server}, "nergy", nil)
+
+	outdoor := 2.5
+	err := p.publishFields("test", struct {
+		Outdoor *float64 `json:"outdoor"`
+		Indoor  *float64 `json:"indoor"`
+	}{Outdoor: &outdoor})
+	assert.NoError(t, err)
+
+	messages := retained(t, server, "nergy/#")
+	assert.Equal(t, "2.5", messages["nergy/test/outdoor"])
+	assert.NotContains(t, messages, "nergy/test/indoor")
+	assert.JSONEq(t, `{"outdoor":2.5,"indoor":null}`, messages["nergy/test"])
+}
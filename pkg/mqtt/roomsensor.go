@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+)
+
+// RoomSensorModel is the model of mqtt room temperature sensors. Defaults are for Zigbee2MQTT where
+// PrimaryID is the friendly name of the sensor.
+const RoomSensorModel = "room-temperature"
+
+// Default max age of data from mqtt meters if Meter.MaxAge is not set. Room sensors often only report on change.
+const (
+	DefaultMaxAge           = 5 * time.Minute
+	DefaultRoomSensorMaxAge = 90 * time.Minute
+)
+
+// RoomSensor keeps the latest temperature from one room sensor.
+type RoomSensor struct {
+	field  config.FieldMapping
+	maxAge time.Duration
+
+	temperature float64
+	time        time.Time
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+func NewRoomSensor(m config.Meter) *RoomSensor {
+	return &RoomSensor{
+		field:  roomSensorField(m),
+		maxAge: MaxAge(m),
+		now:    time.Now,
+	}
+}
+
+// roomSensorField is topic zigbee2mqtt/<PrimaryID> and path temperature unless set by Meter.Topic or Meter.Fields.
+func roomSensorField(m config.Meter) config.FieldMapping {
+	f := config.FieldMapping{Path: "temperature"}
+	if len(m.Fields) > 0 {
+		f = m.Fields[0]
+	}
+	if f.Topic == "" {
+		f.Topic = m.Topic
+	}
+	if f.Topic == "" {
+		f.Topic = "zigbee2mqtt/" + m.PrimaryID
+	}
+	return f
+}
+
+// MaxAge is how old data from an mqtt meter can be before it is ignored.
+func MaxAge(m config.Meter) time.Duration {
+	if m.MaxAge > 0 {
+		return time.Duration(m.MaxAge) * time.Second
+	}
+	if m.Model == RoomSensorModel {
+		return DefaultRoomSensorMaxAge
+	}
+	return DefaultMaxAge
+}
+
+func (r *RoomSensor) Topic() string {
+	return r.field.Topic
+}
+
+func (r *RoomSensor) Handle(payload []byte) error {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		doc = string(bytes.TrimSpace(payload))
+	}
+	t, err := lookup(doc, r.field.Path)
+	if err != nil {
+		return err
+	}
+	if r.field.Scale != 0 {
+		t *= r.field.Scale
+	}
+
+	r.mutex.Lock()
+	r.temperature = t
+	r.time = r.now()
+	r.mutex.Unlock()
+	return nil
+}
+
+// LastReceived is zero if nothing has been received.
+func (r *RoomSensor) LastReceived() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.time
+}
+
+// Temperature returns the latest temperature. It is an error if it is older than max age.
+func (r *RoomSensor) Temperature() (float64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.time.IsZero() {
+		return 0, fmt.Errorf("no temperature received on %s", r.field.Topic)
+	}
+	if age := r.now().Sub(r.time); age > r.maxAge {
+		return 0, fmt.Errorf("temperature on %s is stale: %s old", r.field.Topic, age.Round(time.Second))
+	}
+	return r.temperature, nil
+}
+
+// AggregateTemperatures returns min, average and max. All are nil if temperatures is empty.
+func AggregateTemperatures(temperatures []float64) (min, avg, max *float64) {
+	if len(temperatures) == 0 {
+		return nil, nil, nil
+	}
+	lo, hi, sum := temperatures[0], temperatures[0], 0.0
+	for _, t := range temperatures {
+		if t < lo {
+			lo = t
+		}
+		if t > hi {
+			hi = t
+		}
+		sum += t
+	}
+	mean := sum / float64(len(temperatures))
+	return &lo, &mean, &hi
+}
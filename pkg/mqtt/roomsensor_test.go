@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomSensor(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRoomSensor(config.Meter{InterfaceType: "mqtt", Model: RoomSensorModel, PrimaryID: "livingroom", MaxAge: 600})
+	r.now = func() time.Time { return now }
+	assert.Equal(t, "zigbee2mqtt/livingroom", r.Topic())
+
+	_, err := r.Temperature()
+	assert.ErrorContains(t, err, "no temperature received on zigbee2mqtt/livingroom")
+
+	err = r.Handle([]byte(`{"battery":97,"humidity":41.2,"linkquality":120,"temperature":21.37,"voltage":2985}`))
+	assert.NoError(t, err)
+	temperature, err := r.Temperature()
+	assert.NoError(t, err)
+	assert.Equal(t, 21.37, temperature)
+	assert.Equal(t, now, r.LastReceived())
+
+	now = now.Add(11 * time.Minute)
+	_, err = r.Temperature()
+	assert.ErrorContains(t, err, "stale: 11m0s old")
+
+	err = r.Handle([]byte(`{"battery":97}`))
+	assert.ErrorContains(t, err, "path temperature not found")
+}
+
+func TestRoomSensorField(t *testing.T) {
+	tests := []struct {
+		meter    config.Meter
+		expected config.FieldMapping
+	}{
+		{
+			meter:    config.Meter{PrimaryID: "bedroom"},
+			expected: config.FieldMapping{Topic: "zigbee2mqtt/bedroom", Path: "temperature"},
+		},
+		{
+			meter:    config.Meter{PrimaryID: "bedroom", Topic: "house/bedroom"},
+			expected: config.FieldMapping{Topic: "house/bedroom", Path: "temperature"},
+		},
+		{
+			meter:    config.Meter{Topic: "esphome/sensor/temp/state", Fields: []config.FieldMapping{{Scale: 0.1}}},
+			expected: config.FieldMapping{Topic: "esphome/sensor/temp/state", Scale: 0.1},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, roomSensorField(tt.meter))
+	}
+
+	r := NewRoomSensor(tests[2].meter)
+	assert.NoError(t, r.Handle([]byte("215")))
+	temperature, err := r.Temperature()
+	assert.NoError(t, err)
+	assert.InDelta(t, 21.5, temperature, 0.0001)
+}
+
+func TestAggregateTemperatures(t *testing.T) {
+	min, avg, max := AggregateTemperatures(nil)
+	assert.Nil(t, min)
+	assert.Nil(t, avg)
+	assert.Nil(t, max)
+
+	min, avg, max = AggregateTemperatures([]float64{21, 19.5, 22.5, 21})
+	assert.Equal(t, 19.5, *min)
+	assert.Equal(t, 21.0, *avg)
+	assert.Equal(t, 22.5, *max)
+}
+
+func TestMaxAge(t *testing.T) {
+	assert.Equal(t, DefaultMaxAge, MaxAge(config.Meter{Model: "p1ib"}))
+	assert.Equal(t, DefaultRoomSensorMaxAge, MaxAge(config.Meter{Model: RoomSensorModel}))
+	assert.Equal(t, time.Minute, MaxAge(config.Meter{Model: "p1ib", MaxAge: 60}))
+}
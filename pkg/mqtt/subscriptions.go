@@ -0,0 +1,136 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+)
+
+// Subscriptions keeps the broker subscribed to the topics of the configured mqtt meters.
+// Meters may share a filter. The broker is subscribed once per filter and messages are
+// dispatched to the handlers of all meters using it.
+type Subscriptions struct {
+	broker  Broker
+	meters  map[string]subscribed         // keyed by config.Meter.Identifier
+	filters map[string]map[string]Handler // handlers per filter keyed by config.Meter.Identifier
+	mutex   sync.RWMutex                  // protects filters which are read when dispatching
+}
+
+type subscribed struct {
+	meter   config.Meter
+	filters []string
+}
+
+func NewSubscriptions(broker Broker) *Subscriptions {
+	return &Subscriptions{
+		broker:  broker,
+		meters:  make(map[string]subscribed),
+		filters: make(map[string]map[string]Handler),
+	}
+}
+
+// Update unsubscribes removed or changed meters and subscribes new or changed meters with the handlers
+// returned by handlers. A meter which fails is retried on next update.
+func (s *Subscriptions) Update(meters []config.Meter, handlers func(config.Meter) (map[string]Handler, error)) error {
+	desired := make(map[string]config.Meter)
+	for _, m := range meters {
+		if m.InterfaceType == "mqtt" {
+			desired[m.Identifier()] = m
+		}
+	}
+
+	var errs []error
+	for id, sub := range s.meters {
+		if m, ok := desired[id]; ok && reflect.DeepEqual(m, sub.meter) {
+			continue
+		}
+		for _, filter := range sub.filters {
+			if err := s.remove(filter, id); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delete(s.meters, id)
+	}
+
+	for id, m := range desired {
+		if _, ok := s.meters[id]; ok {
+			continue
+		}
+		hs, err := handlers(m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error mqtt meter %s: %w", id, err))
+			continue
+		}
+		sub := subscribed{meter: m}
+		var subErrs []error
+		for filter, handler := range hs {
+			if err := s.add(filter, id, handler); err != nil {
+				subErrs = append(subErrs, err)
+				continue
+			}
+			sub.filters = append(sub.filters, filter)
+		}
+		if len(subErrs) > 0 {
+			// unsubscribe what succeeded so everything is subscribed again on next update.
+			for _, filter := range sub.filters {
+				subErrs = append(subErrs, s.remove(filter, id))
+			}
+			errs = append(errs, subErrs...)
+			continue
+		}
+		s.meters[id] = sub
+	}
+	return errors.Join(errs...)
+}
+
+// add adds the handler of meter id to filter. The broker is subscribed for the first handler.
+func (s *Subscriptions) add(filter, id string, handler Handler) error {
+	s.mutex.RLock()
+	_, ok := s.filters[filter]
+	s.mutex.RUnlock()
+	if !ok {
+		if err := s.broker.Subscribe(filter, s.dispatch(filter)); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.filters[filter] == nil {
+		s.filters[filter] = make(map[string]Handler)
+	}
+	s.filters[filter][id] = handler
+	return nil
+}
+
+// remove removes the handler of meter id from filter. The broker is unsubscribed after the last handler.
+func (s *Subscriptions) remove(filter, id string) error {
+	s.mutex.Lock()
+	handlers := s.filters[filter]
+	delete(handlers, id)
+	last := len(handlers) == 0
+	if last {
+		delete(s.filters, filter)
+	}
+	s.mutex.Unlock()
+	if !last {
+		return nil
+	}
+	return s.broker.Unsubscribe(filter)
+}
+
+func (s *Subscriptions) dispatch(filter string) Handler {
+	return func(topic string, payload []byte) {
+		s.mutex.RLock()
+		handlers := make([]Handler, 0, len(s.filters[filter]))
+		for _, h := range s.filters[filter] {
+			handlers = append(handlers, h)
+		}
+		s.mutex.RUnlock()
+		for _, h := range handlers {
+			h(topic, payload)
+		}
+	}
+}
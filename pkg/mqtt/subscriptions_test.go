@@ -0,0 +1,130 @@
+package mqtt
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBroker struct {
+	subscribed map[string]Handler
+	fail       map[string]bool
+	calls      []string
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{subscribed: make(map[string]Handler), fail: make(map[string]bool)}
+}
+
+func (f *fakeBroker) Subscribe(filter string, handler Handler) error {
+	f.calls = append(f.calls, "sub "+filter)
+	if f.fail[filter] {
+		return errors.New("subscribe failed")
+	}
+	f.subscribed[filter] = handler
+	return nil
+}
+
+func (f *fakeBroker) Unsubscribe(filter string) error {
+	f.calls = append(f.calls, "unsub "+filter)
+	delete(f.subscribed, filter)
+	return nil
+}
+
+func (f *fakeBroker) Publish(topic string, payload []byte, retain bool) error {
+	if h, ok := f.subscribed[topic]; ok {
+		h(topic, payload)
+	}
+	return nil
+}
+
+func (f *fakeBroker) Close() error {
+	return nil
+}
+
+func (f *fakeBroker) filters() []string {
+	var filters []string
+	for filter := range f.subscribed {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	return filters
+}
+
+func TestSubscriptionsUpdate(t *testing.T) {
+	broker := newFakeBroker()
+	s := NewSubscriptions(broker)
+	handlers := func(m config.Meter) (map[string]Handler, error) {
+		if m.Model == "broken" {
+			return nil, errors.New("broken meter")
+		}
+		return map[string]Handler{m.Topic: func(string, []byte) {}}, nil
+	}
+
+	p1ib := config.Meter{InterfaceType: "mqtt", Model: "p1ib", PrimaryID: "1", Topic: "p1ib/sensor_state"}
+	room := config.Meter{InterfaceType: "mqtt", Model: RoomSensorModel, PrimaryID: "kitchen", Topic: "zigbee2mqtt/kitchen"}
+	mbus := config.Meter{InterfaceType: "mbus", Model: "garo-GNM3D-MBUS", PrimaryID: "1", Topic: "ignored"}
+
+	err := s.Update([]config.Meter{p1ib, room, mbus}, handlers)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p1ib/sensor_state", "zigbee2mqtt/kitchen"}, broker.filters())
+
+	// unchanged meters are not subscribed again
+	broker.calls = nil
+	err = s.Update([]config.Meter{p1ib, room, mbus}, handlers)
+	assert.NoError(t, err)
+	assert.Empty(t, broker.calls)
+
+	// changed meter is subscribed to its new topic and removed meter is unsubscribed
+	room.Topic = "zigbee2mqtt/kitchen_sensor"
+	err = s.Update([]config.Meter{room}, handlers)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"zigbee2mqtt/kitchen_sensor"}, broker.filters())
+
+	// failing meters are retried on next update
+	broken := config.Meter{InterfaceType: "mqtt", Model: "broken", PrimaryID: "2", Topic: "broken"}
+	bedroom := config.Meter{InterfaceType: "mqtt", Model: RoomSensorModel, PrimaryID: "bedroom", Topic: "zigbee2mqtt/bedroom"}
+	broker.fail["zigbee2mqtt/bedroom"] = true
+	err = s.Update([]config.Meter{room, broken, bedroom}, handlers)
+	assert.ErrorContains(t, err, "broken meter")
+	assert.ErrorContains(t, err, "subscribe failed")
+	assert.Equal(t, []string{"zigbee2mqtt/kitchen_sensor"}, broker.filters())
+
+	broker.fail["zigbee2mqtt/bedroom"] = false
+	err = s.Update([]config.Meter{room, bedroom}, handlers)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"zigbee2mqtt/bedroom", "zigbee2mqtt/kitchen_sensor"}, broker.filters())
+
+	err = s.Update(nil, handlers)
+	assert.NoError(t, err)
+	assert.Empty(t, broker.filters())
+}
+
+func TestSubscriptionsSharedFilter(t *testing.T) {
+	broker := newFakeBroker()
+	s := NewSubscriptions(broker)
+	received := make(map[string]int)
+	handlers := func(m config.Meter) (map[string]Handler, error) {
+		return map[string]Handler{m.Topic: func(string, []byte) { received[m.PrimaryID]++ }}, nil
+	}
+
+	power := config.Meter{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "power", Topic: "shellies/em/status"}
+	energy := config.Meter{InterfaceType: "mqtt", Model: GenericModel, PrimaryID: "energy", Topic: "shellies/em/status"}
+
+	assert.NoError(t, s.Update([]config.Meter{power, energy}, handlers))
+	assert.Equal(t, []string{"sub shellies/em/status"}, broker.calls)
+	assert.NoError(t, broker.Publish("shellies/em/status", nil, false))
+	assert.Equal(t, map[string]int{"power": 1, "energy": 1}, received)
+
+	// removing one meter keeps the other subscribed
+	assert.NoError(t, s.Update([]config.Meter{energy}, handlers))
+	assert.Equal(t, []string{"shellies/em/status"}, broker.filters())
+	assert.NoError(t, broker.Publish("shellies/em/status", nil, false))
+	assert.Equal(t, map[string]int{"power": 1, "energy": 2}, received)
+
+	assert.NoError(t, s.Update(nil, handlers))
+	assert.Empty(t, broker.filters())
+}
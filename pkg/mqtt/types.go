@@ -46,17 +46,29 @@ type P1ib struct {
 
 func (p P1ib) AsMeterData(id string) *meter.Data {
 	return &meter.Data{
-		Id:          id,
-		Model:       "p1ib",
-		Current_W:   p.P1IbImportExport * 1000.0,
-		Current_VLL: 0.0,
-		Current_VLN: 0.0,
-		Total_WH:    p.P1IbHourlyActiveImportQ1Q4 * 1000.0,
-		L1_A:        p.P1IbCurrentL1,
-		L2_A:        p.P1IbCurrentL2,
-		L3_A:        p.P1IbCurrentL3,
-		L1_V:        p.P1IbVoltageL1,
-		L2_V:        p.P1IbVoltageL2,
-		L3_V:        p.P1IbVoltageL3,
+		Id:                   id,
+		Model:                "p1ib",
+		Current_W:            p.P1IbImportExport * 1000.0,
+		Current_VLL:          0.0,
+		Current_VLN:          0.0,
+		Total_WH:             p.P1IbHourlyActiveImportQ1Q4 * 1000.0,
+		L1_A:                 p.P1IbCurrentL1,
+		L2_A:                 p.P1IbCurrentL2,
+		L3_A:                 p.P1IbCurrentL3,
+		L1_V:                 p.P1IbVoltageL1,
+		L2_V:                 p.P1IbVoltageL2,
+		L3_V:                 p.P1IbVoltageL3,
+		Import_W:             p.P1IbActivePowerPlusQ1Q4 * 1000.0,
+		Export_W:             p.P1IbActivePowerMinusQ2Q3 * 1000.0,
+		Export_WH:            p.P1IbHourlyActiveExportQ2Q3 * 1000.0,
+		L1_W:                 p.P1IbImportExportL1 * 1000.0,
+		L2_W:                 p.P1IbImportExportL2 * 1000.0,
+		L3_W:                 p.P1IbImportExportL3 * 1000.0,
+		Reactive_VAR:         (p.P1IbReactivePowerPlusQ1Q2 - p.P1IbReactivePowerMinusQ3Q4) * 1000.0,
+		L1_VAR:               (p.P1IbReactivePowerPlusL1 - p.P1IbReactivePowerMinusL1) * 1000.0,
+		L2_VAR:               (p.P1IbReactivePowerPlusL2 - p.P1IbReactivePowerMinusL2) * 1000.0,
+		L3_VAR:               (p.P1IbReactivePowerPlusL3 - p.P1IbReactivePowerMinusL3) * 1000.0,
+		Reactive_Import_VARH: p.P1IbHourlyReactiveImportQ1Q2 * 1000.0,
+		Reactive_Export_VARH: p.P1IbHourlyReactiveExportQ3Q4 * 1000.0,
 	}
 }
@@ -0,0 +1,53 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestP1ibAsMeterData(t *testing.T) {
+	payload := `{
+		"p1ib_hourly_active_import_q1_q4": 76215.335,
+		"p1ib_hourly_active_export_q2_q3": 12925.573,
+		"p1ib_hourly_reactive_import_q1_q2": 7721.648,
+		"p1ib_hourly_reactive_export_q3_q4": 11314.6,
+		"p1ib_active_power_plus_q1_q4": 0,
+		"p1ib_active_power_minus_q2_q3": 2.1,
+		"p1ib_reactive_power_plus_q1_q2": 0,
+		"p1ib_reactive_power_minus_q3_q4": 0.883,
+		"p1ib_active_power_plus_l1": 0.764,
+		"p1ib_active_power_minus_l3": 2.864,
+		"p1ib_reactive_power_minus_l1": 0.32,
+		"p1ib_reactive_power_minus_l2": 0.402,
+		"p1ib_reactive_power_minus_l3": 0.161,
+		"p1ib_voltage_l1": 233.6,
+		"p1ib_voltage_l2": 234,
+		"p1ib_voltage_l3": 232.3,
+		"p1ib_current_l1": 3.5,
+		"p1ib_current_l2": 0,
+		"p1ib_current_l3": 12.4,
+		"p1ib_import_export_l1": 0.764,
+		"p1ib_import_export_l2": 0,
+		"p1ib_import_export_l3": -2.864,
+		"p1ib_import_export": -2.1,
+		"p1ib_meter": "Aidon"
+	}`
+	var p P1ib
+	assert.NoError(t, json.Unmarshal([]byte(payload), &p))
+
+	data := p.AsMeterData("1")
+	assert.InDelta(t, -2100, data.Current_W, 0.001)
+	assert.InDelta(t, 0, data.Import_W, 0.001)
+	assert.InDelta(t, 2100, data.Export_W, 0.001)
+	assert.InDelta(t, 76215335, data.Total_WH, 0.001)
+	assert.InDelta(t, 12925573, data.Export_WH, 0.001)
+	assert.InDelta(t, 764, data.L1_W, 0.001)
+	assert.InDelta(t, 0, data.L2_W, 0.001)
+	assert.InDelta(t, -2864, data.L3_W, 0.001)
+	assert.InDelta(t, -883, data.Reactive_VAR, 0.001)
+	assert.InDelta(t, -320, data.L1_VAR, 0.001)
+	assert.InDelta(t, 7721648, data.Reactive_Import_VARH, 0.001)
+	assert.InDelta(t, 11314600, data.Reactive_Export_VARH, 0.001)
+}
@@ -0,0 +1,129 @@
+package override
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+)
+
+type Kind string
+
+const (
+	Heating  Kind = "heating"
+	Hotwater Kind = "hotwater"
+	Boost    Kind = "boost" // hot water to boost temperature
+)
+
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(s); k {
+	case Heating, Hotwater, Boost:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown override %s", s)
+}
+
+// MaxDuration is the longest override so a forgotten override does not take control forever.
+const MaxDuration = 24 * time.Hour
+
+// ParseDuration parses a command payload. Examples 2h, 90m or 90 (minutes). 0, off or empty cancels the override.
+// Negative durations and durations longer than MaxDuration are rejected.
+func ParseDuration(payload string) (time.Duration, error) {
+	payload = strings.TrimSpace(payload)
+	switch strings.ToLower(payload) {
+	case "", "off", "0":
+		return 0, nil
+	}
+	var d time.Duration
+	if minutes, err := strconv.ParseFloat(payload, 64); err == nil {
+		if !(minutes >= 0 && minutes <= MaxDuration.Minutes()) { // also rejects NaN
+			return 0, fmt.Errorf("override duration %s must be between 0 and %s", payload, MaxDuration)
+		}
+		d = time.Duration(minutes * float64(time.Minute))
+	} else {
+		d, err = time.ParseDuration(payload)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing override duration %s: %w", payload, err)
+		}
+	}
+	if d < 0 || d > MaxDuration {
+		return 0, fmt.Errorf("override duration %s must be between 0 and %s", payload, MaxDuration)
+	}
+	return d, nil
+}
+
+type Override struct {
+	Kind  Kind      `json:"kind"`
+	Until time.Time `json:"until"`
+}
+
+// Overrides are local manual overrides which force heating or hot water on until they expire.
+type Overrides struct {
+	until map[Kind]time.Time
+	mutex sync.Mutex
+	now   func() time.Time
+}
+
+func New() *Overrides {
+	return &Overrides{
+		until: make(map[Kind]time.Time),
+		now:   time.Now,
+	}
+}
+
+// Set activates kind for d. d <= 0 cancels it.
+func (o *Overrides) Set(kind Kind, d time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if d <= 0 {
+		delete(o.until, kind)
+		return
+	}
+	o.until[kind] = o.now().Add(d)
+}
+
+// Clear cancels all overrides.
+func (o *Overrides) Clear() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	clear(o.until)
+}
+
+// Active returns overrides which have not expired sorted by kind.
+func (o *Overrides) Active() []Override {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	now := o.now()
+	active := []Override{}
+	for kind, until := range o.until {
+		if !now.Before(until) {
+			delete(o.until, kind)
+			continue
+		}
+		active = append(active, Override{Kind: kind, Until: until})
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Kind < active[j].Kind
+	})
+	return active
+}
+
+// Apply returns h with active overrides applied.
+func (o *Overrides) Apply(h config.HourConfig) config.HourConfig {
+	for _, a := range o.Active() {
+		switch a.Kind {
+		case Heating:
+			h.Heating = true
+		case Hotwater:
+			h.Hotwater = true
+		case Boost:
+			h.Hotwater = true
+			h.HotwaterForce = true
+		}
+	}
+	return h
+}
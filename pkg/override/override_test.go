@@ -0,0 +1,70 @@
+package override
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected time.Duration
+		err      bool
+	}{
+		{"2h", 2 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"90", 90 * time.Minute, false},
+		{" 1.5 ", 90 * time.Second, false},
+		{"off", 0, false},
+		{"0", 0, false},
+		{"", 0, false},
+		{"24h", 24 * time.Hour, false},
+		{"1440", 24 * time.Hour, false},
+		{"24h1s", 0, true},
+		{"100000h", 0, true},
+		{"1e9", 0, true},
+		{"-5", 0, true},
+		{"-1h", 0, true},
+		{"NaN", 0, true},
+		{"forever", 0, true},
+	}
+	for _, tt := range tests {
+		d, err := ParseDuration(tt.payload)
+		if tt.err {
+			assert.Error(t, err, tt.payload)
+			continue
+		}
+		assert.NoError(t, err, tt.payload)
+		assert.Equal(t, tt.expected, d, tt.payload)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	o := New()
+	o.now = func() time.Time { return now }
+
+	o.Set(Heating, time.Hour)
+	o.Set(Boost, 30*time.Minute)
+	assert.Equal(t, []Override{
+		{Kind: Boost, Until: now.Add(30 * time.Minute)},
+		{Kind: Heating, Until: now.Add(time.Hour)},
+	}, o.Active())
+
+	h := o.Apply(config.HourConfig{Price: 1})
+	assert.Equal(t, config.HourConfig{Price: 1, Heating: true, Hotwater: true, HotwaterForce: true}, h)
+
+	now = now.Add(45 * time.Minute)
+	h = o.Apply(config.HourConfig{})
+	assert.Equal(t, config.HourConfig{Heating: true}, h)
+
+	o.Set(Heating, 0)
+	assert.Empty(t, o.Active())
+	assert.Equal(t, config.HourConfig{}, o.Apply(config.HourConfig{}))
+
+	_, err := ParseKind("cooling")
+	assert.Error(t, err)
+}
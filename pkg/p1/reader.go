@@ -0,0 +1,155 @@
+package p1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonaz/serial"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/sirupsen/logrus"
+)
+
+// maxTelegramSize discards garbage when the end of a telegram is lost.
+const maxTelegramSize = 8192
+
+// Reader reads telegrams from the P1/HAN port of an electricity meter. The latest valid telegram is cached.
+type Reader struct {
+	device   string
+	baudRate int
+
+	telegram *Telegram
+	time     time.Time
+	cancel   context.CancelFunc
+	mutex    sync.RWMutex
+}
+
+func New(device string, baudRate int) *Reader {
+	return &Reader{
+		device:   device,
+		baudRate: baudRate,
+	}
+}
+
+// Device is the serial device of the port.
+func (r *Reader) Device() string {
+	return r.device
+}
+
+// Start reads telegrams until ctx is done or Stop is called. The device is reopened on errors.
+func (r *Reader) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.mutex.Lock()
+	r.cancel = cancel
+	r.mutex.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			err := r.readDevice(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.Errorf("error reading p1 port %s: %s", r.device, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+// Stop stops reading and closes the device.
+func (r *Reader) Stop() {
+	r.mutex.RLock()
+	cancel := r.cancel
+	r.mutex.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (r *Reader) readDevice(ctx context.Context) error {
+	port, err := serial.OpenPort(&serial.Config{
+		Name: r.device,
+		Baud: r.baudRate,
+		Size: 8,
+	})
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		port.Close()
+	})
+	defer func() {
+		if stop() {
+			port.Close()
+		}
+	}()
+	return r.read(port)
+}
+
+// read reads telegrams from reader until error. Data before the first / is skipped.
+func (r *Reader) read(reader io.Reader) error {
+	buf := bufio.NewReader(reader)
+	var telegram []byte
+	for {
+		line, err := buf.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(line, []byte("/")) {
+			telegram = telegram[:0]
+		} else if len(telegram) == 0 {
+			continue
+		}
+		telegram = append(telegram, line...)
+		if len(telegram) > maxTelegramSize {
+			telegram = telegram[:0]
+			continue
+		}
+		if !bytes.HasPrefix(line, []byte("!")) {
+			continue
+		}
+		if err := r.Feed(telegram); err != nil {
+			logrus.Debugf("p1: %s", err)
+		}
+		telegram = telegram[:0]
+	}
+}
+
+// Feed parses and caches one telegram.
+func (r *Reader) Feed(data []byte) error {
+	t, err := ParseTelegram(data)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	r.telegram = t
+	r.time = time.Now()
+	r.mutex.Unlock()
+	return nil
+}
+
+// LastReceived is zero if no valid telegram has been received.
+func (r *Reader) LastReceived() time.Time {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.time
+}
+
+// ReadValues returns the values of the latest telegram.
+func (r *Reader) ReadValues(model, id string) (*meter.Data, error) {
+	r.mutex.RLock()
+	t, received := r.telegram, r.time
+	r.mutex.RUnlock()
+	if t == nil {
+		return nil, fmt.Errorf("no telegram received from p1 port %s", r.device)
+	}
+	return t.Data(model, id, received), nil
+}
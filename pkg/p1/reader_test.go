@@ -0,0 +1,41 @@
+package p1
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	r := New("/dev/null", 115200)
+	_, err := r.ReadValues("p1", "1")
+	assert.ErrorContains(t, err, "no telegram received from p1 port /dev/null")
+
+	imported := readTelegram(t, "import")
+	exported := readTelegram(t, "export")
+	var stream []byte
+	stream = append(stream, imported[40:]...) // started reading in the middle of a telegram
+	stream = append(stream, imported...)
+	stream = append(stream, bytes.Replace(exported, []byte("236.2"), []byte("236.3"), 1)...) // corrupt telegram is ignored
+
+	err = r.read(bytes.NewReader(stream))
+	assert.ErrorIs(t, err, io.EOF)
+
+	data, err := r.ReadValues("p1", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 232.8, data.L1_V)
+	assert.Equal(t, 12345678.0, data.Total_WH)
+	assert.False(t, data.Time.IsZero())
+}
+
+func TestStop(t *testing.T) {
+	r := New("/dev/does-not-exist", 115200)
+	wg := &sync.WaitGroup{}
+	r.Start(context.Background(), wg)
+	r.Stop()
+	wg.Wait()
+}
@@ -0,0 +1,153 @@
+package p1
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+)
+
+// Telegram is a DSMR 5 / IEC 62056-21 telegram from a P1 or HAN port.
+type Telegram struct {
+	Header  string            // meter identification after the leading /. example ADN9 6534
+	Objects map[string]string // raw value of the last group keyed by OBIS code. example 1-0:1.8.0 -> 00006678.394*kWh
+}
+
+// ParseTelegram parses one telegram from / to the CRC after ! and verifies the CRC.
+func ParseTelegram(data []byte) (*Telegram, error) {
+	start := bytes.IndexByte(data, '/')
+	end := bytes.IndexByte(data, '!')
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("p1 telegram must start with / and end with !")
+	}
+	checksum := strings.TrimSpace(string(data[end+1:]))
+	if checksum == "" {
+		return nil, fmt.Errorf("p1 telegram has no crc")
+	}
+	expected, err := strconv.ParseUint(checksum, 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p1 telegram crc %q", checksum)
+	}
+	if crc := crc16(data[start : end+1]); uint16(expected) != crc {
+		return nil, fmt.Errorf("p1 telegram crc mismatch got %04X expected %04X", crc, expected)
+	}
+
+	lines := strings.Split(string(data[start+1:end]), "\n")
+	t := &Telegram{
+		Header:  strings.TrimSpace(lines[0]),
+		Objects: make(map[string]string),
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		code, values, ok := strings.Cut(line, "(")
+		if !ok || !strings.HasSuffix(values, ")") {
+			continue
+		}
+		// objects like the power failure log have several groups. the value is always the last one.
+		groups := strings.Split(strings.TrimSuffix(values, ")"), ")(")
+		t.Objects[code] = groups[len(groups)-1]
+	}
+	return t, nil
+}
+
+// crc16 is CRC-16/ARC as used by DSMR.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// unitScale converts to the units used in meter.Data.
+var unitScale = map[string]float64{
+	"kWh":   1000,
+	"Wh":    1,
+	"kW":    1000,
+	"W":     1,
+	"kvarh": 1000,
+	"varh":  1,
+	"kvar":  1000,
+	"var":   1,
+	"V":     1,
+	"A":     1,
+}
+
+// Value returns the value of OBIS code converted to Wh, W, varh, var, V or A.
+func (t *Telegram) Value(code string) (float64, bool) {
+	raw, ok := t.Objects[code]
+	if !ok {
+		return 0, false
+	}
+	number, unit, _ := strings.Cut(raw, "*")
+	scale, ok := unitScale[unit]
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+// Data maps the OBIS codes of t to meter data. Current_W is import minus export like p1ib.
+func (t *Telegram) Data(model, id string, received time.Time) *meter.Data {
+	data := &meter.Data{
+		Id:    id,
+		Model: model,
+		Time:  received,
+	}
+	fields := map[string]*float64{
+		"1-0:1.8.0":  &data.Total_WH,
+		"1-0:2.8.0":  &data.Export_WH,
+		"1-0:3.8.0":  &data.Reactive_Import_VARH,
+		"1-0:4.8.0":  &data.Reactive_Export_VARH,
+		"1-0:1.7.0":  &data.Import_W,
+		"1-0:2.7.0":  &data.Export_W,
+		"1-0:32.7.0": &data.L1_V,
+		"1-0:52.7.0": &data.L2_V,
+		"1-0:72.7.0": &data.L3_V,
+		"1-0:31.7.0": &data.L1_A,
+		"1-0:51.7.0": &data.L2_A,
+		"1-0:71.7.0": &data.L3_A,
+	}
+	for code, field := range fields {
+		if v, ok := t.Value(code); ok {
+			*field = v
+		}
+	}
+
+	// OBIS codes of import and export for the net values
+	net := []struct {
+		field       *float64
+		plus, minus string
+	}{
+		{&data.Current_W, "1-0:1.7.0", "1-0:2.7.0"},
+		{&data.L1_W, "1-0:21.7.0", "1-0:22.7.0"},
+		{&data.L2_W, "1-0:41.7.0", "1-0:42.7.0"},
+		{&data.L3_W, "1-0:61.7.0", "1-0:62.7.0"},
+		{&data.Reactive_VAR, "1-0:3.7.0", "1-0:4.7.0"},
+		{&data.L1_VAR, "1-0:23.7.0", "1-0:24.7.0"},
+		{&data.L2_VAR, "1-0:43.7.0", "1-0:44.7.0"},
+		{&data.L3_VAR, "1-0:63.7.0", "1-0:64.7.0"},
+	}
+	for _, n := range net {
+		plus, okPlus := t.Value(n.plus)
+		minus, okMinus := t.Value(n.minus)
+		if okPlus || okMinus {
+			*n.field = plus - minus
+		}
+	}
+	return data
+}
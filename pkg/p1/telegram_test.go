@@ -0,0 +1,163 @@
+package p1
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/stretchr/testify/assert"
+)
+
+// readTelegram reads a telegram from testdata. han-example is the example telegram with its original crc
+// from the Swedish HAN port recommendation (Energiföretagen, lokalt kundgränssnitt för elmätare). The others
+// are synthetic telegrams in the same format. No captures from Aidon, Kaifa or Landis+Gyr meters are available yet.
+func readTelegram(t *testing.T, name string) []byte {
+	b, err := os.ReadFile("testdata/" + name + ".txt")
+	assert.NoError(t, err)
+	return b
+}
+
+func TestCRC16(t *testing.T) {
+	assert.Equal(t, uint16(0xbb3d), crc16([]byte("123456789")))
+}
+
+func TestParseTelegram(t *testing.T) {
+	received := time.Date(2023, 10, 19, 15, 30, 10, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   *meter.Data
+	}{
+		{
+			name:   "han-example",
+			header: `ELL5\253833635_A`,
+			want: &meter.Data{
+				Total_WH:  6678394,
+				Current_W: 1727,
+				Import_W:  1727,
+				L1_W:      1023, L2_W: 350, L3_W: 353,
+				Reactive_VAR: -309,
+				L1_VAR:       -9, L2_VAR: -161, L3_VAR: -138,
+				Reactive_Import_VARH: 21988,
+				Reactive_Export_VARH: 1020971,
+				L1_V:                 240.3, L2_V: 240.1, L3_V: 241.3,
+				L1_A: 4.2, L2_A: 1.6, L3_A: 1.7,
+			},
+		},
+		{
+			name:   "import",
+			header: "XXX5SYNTHETIC-IMPORT",
+			want: &meter.Data{
+				Total_WH:  12345678,
+				Current_W: 1727,
+				Import_W:  1727,
+				L1_W:      544, L2_W: 612, L3_W: 571,
+				Reactive_VAR: -319,
+				L1_VAR:       -102, L2_VAR: -113, L3_VAR: -104,
+				Reactive_Import_VARH: 1234567,
+				Reactive_Export_VARH: 456789,
+				L1_V:                 232.8, L2_V: 233.5, L3_V: 231.9,
+				L1_A: 2.4, L2_A: 2.7, L3_A: 2.5,
+			},
+		},
+		{
+			name:   "import-no-phase-var",
+			header: "XXX5SYNTHETIC-NO-PHASE-VAR",
+			want: &meter.Data{
+				Total_WH:  4827512,
+				Current_W: 3146,
+				Import_W:  3146,
+				L1_W:      2204, L2_W: 388, L3_W: 554,
+				Reactive_VAR:         -402,
+				Reactive_Import_VARH: 514103,
+				Reactive_Export_VARH: 921440,
+				L1_V:                 229.1, L2_V: 230.4, L3_V: 230.0,
+				L1_A: 9.6, L2_A: 1.7, L3_A: 2.4,
+			},
+		},
+		{
+			name:   "export",
+			header: "XXX5SYNTHETIC-EXPORT",
+			want: &meter.Data{
+				Total_WH:  9182001,
+				Export_WH: 2310745,
+				Current_W: -4215,
+				Export_W:  4215,
+				L1_W:      -1390, L2_W: -1421, L3_W: -1404,
+				Reactive_VAR: -587,
+				L1_VAR:       -195, L2_VAR: -201, L3_VAR: -191,
+				Reactive_Import_VARH: 31223,
+				Reactive_Export_VARH: 1505921,
+				L1_V:                 236.2, L2_V: 235.8, L3_V: 236.5,
+				L1_A: 6.0, L2_A: 6.1, L3_A: 6.0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tel, err := ParseTelegram(readTelegram(t, tt.name))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.header, tel.Header)
+
+			tt.want.Id = "1"
+			tt.want.Model = "p1"
+			tt.want.Time = received
+			data := tel.Data("p1", "1", received)
+			assert.InDeltaMapValues(t, toMap(tt.want), toMap(data), 0.001)
+			assert.Equal(t, tt.want.Id, data.Id)
+			assert.Equal(t, received, data.Time)
+		})
+	}
+}
+
+func toMap(d *meter.Data) map[string]float64 {
+	return map[string]float64{
+		"w": d.Current_W, "wh": d.Total_WH, "import_w": d.Import_W, "export_w": d.Export_W, "export_wh": d.Export_WH,
+		"l1_w": d.L1_W, "l2_w": d.L2_W, "l3_w": d.L3_W,
+		"var": d.Reactive_VAR, "l1_var": d.L1_VAR, "l2_var": d.L2_VAR, "l3_var": d.L3_VAR,
+		"import_varh": d.Reactive_Import_VARH, "export_varh": d.Reactive_Export_VARH,
+		"l1_v": d.L1_V, "l2_v": d.L2_V, "l3_v": d.L3_V,
+		"l1_a": d.L1_A, "l2_a": d.L2_A, "l3_a": d.L3_A,
+	}
+}
+
+func TestParseTelegramErrors(t *testing.T) {
+	valid := readTelegram(t, "import")
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{name: "corrupt", data: bytes.Replace(valid, []byte("232.8"), []byte("232.9"), 1), err: "p1 telegram crc mismatch"},
+		{name: "no crc", data: valid[:bytes.IndexByte(valid, '!')+1], err: "p1 telegram has no crc"},
+		{name: "invalid crc", data: append(valid[:bytes.IndexByte(valid, '!')+1:bytes.IndexByte(valid, '!')+1], "XYZ"...), err: "invalid p1 telegram crc"},
+		{name: "truncated", data: valid[:100], err: "p1 telegram must start with / and end with !"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTelegram(tt.data)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseTelegramGroups(t *testing.T) {
+	data := []byte("/ISK5\\2M550T-1012\r\n\r\n" +
+		"1-0:99.97.0(2)(0-0:96.7.19)(180110092429W)(0000000346*s)(180312102003W)(0000003263*s)\r\n" +
+		"0-1:24.2.1(231019153000S)(01234.567*m3)\r\n" +
+		"!")
+	data = append(data, []byte(crcString(data))...)
+	tel, err := ParseTelegram(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "0000003263*s", tel.Objects["1-0:99.97.0"])
+	assert.Equal(t, "01234.567*m3", tel.Objects["0-1:24.2.1"])
+	_, ok := tel.Value("0-1:24.2.1")
+	assert.False(t, ok)
+}
+
+func crcString(data []byte) string {
+	return fmt.Sprintf("%04X", crc16(data))
+}
@@ -0,0 +1,368 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrFull   = errors.New("queue full")
+	ErrClosed = errors.New("queue closed")
+)
+
+const (
+	recordPush byte = 1
+	recordPop  byte = 2
+
+	headerSize    = 9 // type, length and crc32
+	maxRecordSize = 16 << 20
+
+	// compactSlack is added to twice the size of the queued items before the log is rewritten.
+	// Rewriting only when the log is twice as large keeps the cost of compaction proportional to the pops.
+	compactSlack = 1 << 20
+)
+
+// Queue is a FIFO queue of byte slices persisted to an append-only log. Pushes and pops are
+// appended to the log and fsynced in batches by Start to limit flash wear. Items pushed or popped
+// after the last sync may be lost or replayed after a power loss.
+type Queue struct {
+	file         string
+	maxSize      int
+	syncInterval time.Duration
+
+	items  [][]byte
+	size   int // sum of len(items)
+	log    *os.File
+	logLen int64
+	dirty  bool
+	closed bool
+	notify chan struct{}
+	mutex  sync.Mutex
+}
+
+// Open replays the log in file. Empty file means the queue is only kept in memory.
+// maxSize limits the total size of the queued items in bytes. 0 means no limit.
+func Open(file string, maxSize int, syncInterval time.Duration) (*Queue, error) {
+	q := &Queue{
+		file:         file,
+		maxSize:      maxSize,
+		syncInterval: syncInterval,
+		notify:       make(chan struct{}, 1),
+	}
+	if file == "" {
+		return q, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return nil, err
+	}
+	q.log, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = q.replay()
+	if err != nil {
+		q.log.Close()
+		return nil, fmt.Errorf("error replaying queue %s: %w", file, err)
+	}
+	if len(q.items) > 0 {
+		logrus.Infof("replayed %d queued requests from %s", len(q.items), file)
+	}
+	return q, q.compact()
+}
+
+// replay reads the log until the end or the first damaged record which is truncated away.
+func (q *Queue) replay() error {
+	r := bufio.NewReader(q.log)
+	var offset int64
+	for {
+		typ, data, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			logrus.Warnf("truncating queue %s at %d: %s", q.file, offset, err)
+			break
+		}
+		switch typ {
+		case recordPush:
+			q.items = append(q.items, data)
+			q.size += len(data)
+		case recordPop:
+			n := 1
+			if len(data) == 4 {
+				n = int(binary.BigEndian.Uint32(data))
+			}
+			n = min(n, len(q.items))
+			for _, item := range q.items[:n] {
+				q.size -= len(item)
+			}
+			q.items = q.items[n:]
+		}
+		offset += int64(headerSize + len(data))
+	}
+	q.logLen = offset
+	err := q.log.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	_, err = q.log.Seek(offset, io.SeekStart)
+	return err
+}
+
+func readRecord(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(r, header)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return 0, nil, io.EOF
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("incomplete record header: %w", err)
+	}
+	typ := header[0]
+	if typ != recordPush && typ != recordPop {
+		return 0, nil, fmt.Errorf("unknown record type %d", typ)
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length > maxRecordSize {
+		return 0, nil, fmt.Errorf("record length %d too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, fmt.Errorf("incomplete record: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[5:9]) {
+		return 0, nil, fmt.Errorf("record crc mismatch")
+	}
+	return typ, data, nil
+}
+
+func appendRecord(b []byte, typ byte, data []byte) []byte {
+	b = append(b, typ)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(data))
+	return append(b, data...)
+}
+
+// write appends a record. A partially written record is truncated away so the log stays valid.
+func (q *Queue) write(typ byte, data []byte) error {
+	if q.log == nil {
+		return nil
+	}
+	q.dirty = true
+	_, err := q.log.Write(appendRecord(nil, typ, data))
+	if err != nil {
+		if terr := q.log.Truncate(q.logLen); terr != nil {
+			return errors.Join(err, terr)
+		}
+		_, serr := q.log.Seek(q.logLen, io.SeekStart)
+		return errors.Join(err, serr)
+	}
+	q.logLen += int64(headerSize + len(data))
+	return nil
+}
+
+// compact rewrites the log with only the queued items when it has grown too much.
+func (q *Queue) compact() error {
+	if q.log == nil {
+		return nil
+	}
+	if len(q.items) == 0 {
+		if q.logLen == 0 {
+			return nil
+		}
+		if err := q.log.Truncate(0); err != nil {
+			return err
+		}
+		_, err := q.log.Seek(0, io.SeekStart)
+		q.logLen = 0
+		q.dirty = true
+		return err
+	}
+	if q.logLen <= 2*int64(q.size+headerSize*len(q.items))+compactSlack {
+		return nil
+	}
+
+	tmp := q.file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var size int64
+	for _, item := range q.items {
+		n, err := w.Write(appendRecord(nil, recordPush, item))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		size += int64(n)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.file)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	q.log.Close()
+	q.log = f
+	q.logLen = size
+	q.dirty = false
+	return nil
+}
+
+// Push adds data to the end of the queue.
+func (q *Queue) Push(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if q.maxSize > 0 && q.size+len(data) > q.maxSize {
+		return ErrFull
+	}
+	err := q.write(recordPush, data)
+	if err != nil {
+		return err
+	}
+	q.items = append(q.items, data)
+	q.size += len(data)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek returns the first item without removing it.
+func (q *Queue) Peek() ([]byte, bool) {
+	items := q.PeekN(1)
+	if len(items) == 0 {
+		return nil, false
+	}
+	return items[0], true
+}
+
+// PeekN returns up to n items from the start of the queue without removing them.
+func (q *Queue) PeekN(n int) [][]byte {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	n = min(n, len(q.items))
+	return append([][]byte(nil), q.items[:n]...)
+}
+
+// Pop removes the first item.
+func (q *Queue) Pop() error {
+	return q.PopN(1)
+}
+
+// PopN removes up to n items from the start of the queue.
+func (q *Queue) PopN(n int) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	n = min(n, len(q.items))
+	if n <= 0 {
+		return nil
+	}
+	for i, item := range q.items[:n] {
+		q.size -= len(item)
+		q.items[i] = nil
+	}
+	q.items = q.items[n:]
+
+	var data []byte // empty means one item
+	if n > 1 {
+		data = binary.BigEndian.AppendUint32(nil, uint32(n))
+	}
+	if err := q.write(recordPop, data); err != nil {
+		return err
+	}
+	return q.compact()
+}
+
+// Len is the number of queued items.
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// Notify receives after items are pushed.
+func (q *Queue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// Sync flushes the log to disk if anything has been written since the last sync.
+func (q *Queue) Sync() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.log == nil || !q.dirty || q.closed {
+		return nil
+	}
+	q.dirty = false
+	return q.log.Sync()
+}
+
+// Close syncs and closes the log.
+func (q *Queue) Close() error {
+	err := q.Sync()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return err
+	}
+	q.closed = true
+	if q.log != nil {
+		return errors.Join(err, q.log.Close())
+	}
+	return err
+}
+
+// Start syncs every sync interval and a last time when ctx is done. The queue can still be
+// used after ctx is done but is not synced again.
+func (q *Queue) Start(ctx context.Context, wg *sync.WaitGroup) {
+	interval := q.syncInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if err := q.Sync(); err != nil {
+					logrus.Errorf("error syncing queue %s: %s", q.file, err)
+				}
+				return
+			case <-ticker.C:
+				if err := q.Sync(); err != nil {
+					logrus.Errorf("error syncing queue %s: %s", q.file, err)
+				}
+			}
+		}
+	}()
+}
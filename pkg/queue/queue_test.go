@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func open(t *testing.T, file string, maxSize int) *Queue {
+	q, err := Open(file, maxSize, time.Second)
+	assert.NoError(t, err)
+	return q
+}
+
+func items(q *Queue) []string {
+	var result []string
+	for _, item := range q.items {
+		result = append(result, string(item))
+	}
+	return result
+}
+
+func TestQueueReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue", "nergyqueue")
+	q := open(t, file, 0)
+	assert.NoError(t, q.Push([]byte("1")))
+	assert.NoError(t, q.Push([]byte("2")))
+	assert.NoError(t, q.Push([]byte("3")))
+	assert.NoError(t, q.Pop())
+	assert.NoError(t, q.Close())
+	assert.ErrorIs(t, q.Push([]byte("4")), ErrClosed)
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"2", "3"}, items(q))
+	item, ok := q.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "2", string(item))
+	assert.NoError(t, q.Pop())
+	assert.NoError(t, q.Pop())
+	_, ok = q.Peek()
+	assert.False(t, ok)
+	assert.NoError(t, q.Close())
+
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size()) // log is truncated when the queue is empty
+}
+
+func TestQueueTornWrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	assert.NoError(t, q.Push([]byte("1")))
+	assert.NoError(t, q.Push([]byte("2")))
+	assert.NoError(t, q.Close())
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(file, b[:len(b)-1], 0600))
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"1"}, items(q))
+	assert.NoError(t, q.Push([]byte("3")))
+	assert.NoError(t, q.Close())
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"1", "3"}, items(q))
+	assert.NoError(t, q.Close())
+}
+
+func TestQueueCorruptRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	assert.NoError(t, q.Push([]byte("first")))
+	assert.NoError(t, q.Push([]byte("second")))
+	assert.NoError(t, q.Close())
+
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	b[len(b)-1] = 'X'
+	assert.NoError(t, os.WriteFile(file, b, 0600))
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"first"}, items(q))
+	assert.NoError(t, q.Close())
+}
+
+func TestQueueFull(t *testing.T) {
+	q := open(t, "", 10)
+	assert.NoError(t, q.Push([]byte("12345")))
+	assert.NoError(t, q.Push([]byte("12345")))
+	assert.ErrorIs(t, q.Push([]byte("1")), ErrFull)
+	assert.Equal(t, 2, q.Len())
+	assert.NoError(t, q.Pop())
+	assert.NoError(t, q.Push([]byte("1")))
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestQueueCompact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	item := make([]byte, 1024)
+	for i := 0; i < 2048; i++ {
+		assert.NoError(t, q.Push(item))
+	}
+	for i := 0; i < 2040; i++ {
+		assert.NoError(t, q.Pop())
+	}
+	assert.Equal(t, 8, q.Len())
+	assert.NoError(t, q.Close())
+
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Less(t, info.Size(), int64(compactSlack+2*8*(1024+headerSize)))
+
+	q = open(t, file, 0)
+	assert.Equal(t, 8, q.Len())
+	assert.NoError(t, q.Close())
+}
+
+func TestQueuePushWriteError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	assert.NoError(t, q.Push([]byte("1")))
+	q.log.Close() // make writes fail
+	assert.Error(t, q.Push([]byte("2")))
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestQueueNotify(t *testing.T) {
+	q := open(t, "", 0)
+	select {
+	case <-q.Notify():
+		t.Fatal("notified before push")
+	default:
+	}
+	assert.NoError(t, q.Push([]byte("1")))
+	assert.NoError(t, q.Push([]byte("2")))
+	select {
+	case <-q.Notify():
+	default:
+		t.Fatal("not notified after push")
+	}
+}
+
+func TestQueueStart(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	q.Start(ctx, wg)
+	assert.NoError(t, q.Push([]byte("1")))
+	cancel()
+	wg.Wait()
+	assert.False(t, q.dirty)
+	assert.NoError(t, q.Push([]byte("2")))
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"1", "2"}, items(q))
+	assert.NoError(t, q.Close())
+}
+
+func TestQueuePopN(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nergyqueue")
+	q := open(t, file, 0)
+	for _, item := range []string{"1", "2", "3", "4", "5"} {
+		assert.NoError(t, q.Push([]byte(item)))
+	}
+	batch := q.PeekN(3)
+	assert.Len(t, batch, 3)
+	assert.Equal(t, "3", string(batch[2]))
+	assert.NoError(t, q.PopN(3))
+	assert.Len(t, q.PeekN(10), 2)
+	assert.NoError(t, q.Close())
+
+	q = open(t, file, 0)
+	assert.Equal(t, []string{"4", "5"}, items(q))
+	assert.NoError(t, q.PopN(10))
+	assert.Equal(t, 0, q.Len())
+	assert.NoError(t, q.Close())
+}
@@ -41,6 +41,8 @@ type State struct {
 
 	HeatingAllowed  *bool `json:"heatingAllowed,omitempty"`
 	HotwaterAllowed *bool `json:"hotwaterAllowed,omitempty"`
+
+	QueueDepth *int `json:"queueDepth,omitempty"` // requests waiting to be sent to the cloud
 }
 
 type Cache struct {
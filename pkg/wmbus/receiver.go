@@ -0,0 +1,212 @@
+package wmbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jonaz/serial"
+	"github.com/nergy-se/controller/pkg/api/v1/meter"
+	"github.com/nergy-se/controller/pkg/mbus"
+	"github.com/sirupsen/logrus"
+)
+
+type received struct {
+	records []mbus.Record
+	time    time.Time
+}
+
+// Receiver reads telegrams from a wM-Bus receiver stick in transparent mode which outputs
+// each telegram starting with the L-field and without CRCs. The latest telegram per configured
+// meter is cached and telegrams from other meters are dropped.
+type Receiver struct {
+	device   string
+	baudRate int
+
+	keys   map[string][]byte // configured meters, nil key for unencrypted meters
+	meters map[string]*received
+	cancel context.CancelFunc
+	mutex  sync.RWMutex
+}
+
+func New(device string, baudRate int) *Receiver {
+	return &Receiver{
+		device:   device,
+		baudRate: baudRate,
+		keys:     make(map[string][]byte),
+		meters:   make(map[string]*received),
+	}
+}
+
+// SetKey configures meter id with the hex encoded AES key. Empty key means the meter sends unencrypted telegrams.
+func (r *Receiver) SetKey(id, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if key == "" {
+		r.keys[id] = nil
+		return nil
+	}
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("error decoding key for wmbus meter %s: %w", id, err)
+	}
+	if len(k) != 16 {
+		return fmt.Errorf("key for wmbus meter %s must be 16 bytes got %d", id, len(k))
+	}
+	r.keys[id] = k
+	return nil
+}
+
+// Device is the serial device of the receiver.
+func (r *Receiver) Device() string {
+	return r.device
+}
+
+// Retain forgets keys and telegrams of all meters except ids.
+func (r *Receiver) Retain(ids []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id := range r.keys {
+		if !slices.Contains(ids, id) {
+			delete(r.keys, id)
+		}
+	}
+	for id := range r.meters {
+		if !slices.Contains(ids, id) {
+			delete(r.meters, id)
+		}
+	}
+}
+
+// Start reads telegrams until ctx is done or Stop is called. The device is reopened on errors.
+func (r *Receiver) Start(ctx context.Context, wg *sync.WaitGroup) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.mutex.Lock()
+	r.cancel = cancel
+	r.mutex.Unlock()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			err := r.readDevice(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.Errorf("error reading wmbus receiver %s: %s", r.device, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+// Stop stops reading and closes the device.
+func (r *Receiver) Stop() {
+	r.mutex.RLock()
+	cancel := r.cancel
+	r.mutex.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (r *Receiver) readDevice(ctx context.Context) error {
+	port, err := serial.OpenPort(&serial.Config{
+		Name: r.device,
+		Baud: r.baudRate,
+		Size: 8,
+	})
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		port.Close()
+	})
+	defer func() {
+		if stop() {
+			port.Close()
+		}
+	}()
+	return r.read(port)
+}
+
+// read reads telegrams from reader until error.
+func (r *Receiver) read(reader io.Reader) error {
+	buf := bufio.NewReader(reader)
+	for {
+		l, err := buf.ReadByte()
+		if err != nil {
+			return err
+		}
+		telegram := make([]byte, int(l)+1)
+		telegram[0] = l
+		if _, err := io.ReadFull(buf, telegram[1:]); err != nil {
+			return err
+		}
+		if err := r.Feed(telegram); err != nil {
+			logrus.Debugf("wmbus: %s", err)
+		}
+	}
+}
+
+// Feed decrypts, decodes and caches one telegram from a configured meter.
+func (r *Receiver) Feed(data []byte) error {
+	t, err := ParseTelegram(data)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.RLock()
+	key, ok := r.keys[t.ID]
+	r.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("wmbus meter %s is not configured", t.ID)
+	}
+	if t.Encrypted() {
+		if key == nil {
+			return fmt.Errorf("no key for wmbus meter %s", t.ID)
+		}
+		if err := t.Decrypt(key); err != nil {
+			return err
+		}
+	}
+
+	lf, err := t.LongFrame()
+	if err != nil {
+		return err
+	}
+	records, err := mbus.Decode(lf)
+	if err != nil {
+		return fmt.Errorf("error decoding telegram from %s: %w", t.ID, err)
+	}
+
+	r.mutex.Lock()
+	r.meters[t.ID] = &received{records: records, time: time.Now()}
+	r.mutex.Unlock()
+	return nil
+}
+
+// ReadValues returns the latest values received from meter id.
+func (r *Receiver) ReadValues(model, id string) (*meter.Data, error) {
+	r.mutex.RLock()
+	m, ok := r.meters[id]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no telegram received from wmbus meter %s", id)
+	}
+
+	data := &meter.Data{
+		Id:    id,
+		Model: model,
+		Time:  m.time,
+	}
+	mbus.Apply(model, data, m.records)
+	return data, nil
+}
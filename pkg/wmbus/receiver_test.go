@@ -0,0 +1,159 @@
+package wmbus
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f"
+
+// records are energy 12345 kWh, volume 1234.56 m3, flow temperature 45.12 C and return temperature 38.90 C.
+var records = []byte{
+	0x04, 0x06, 0x39, 0x30, 0x00, 0x00,
+	0x04, 0x14, 0x40, 0xe2, 0x01, 0x00,
+	0x02, 0x59, 0xa0, 0x11,
+	0x02, 0x5d, 0x32, 0x0f,
+}
+
+// telegram builds a short header telegram from Kamstrup heat meter 12345678 encrypted with key if set.
+func telegram(t *testing.T, key string, payload []byte) []byte {
+	address := []byte{0x2d, 0x2c, 0x78, 0x56, 0x34, 0x12, 0x1b, 0x04}
+	access := byte(0x2a)
+	cw := []byte{0x00, 0x00}
+	if key != "" {
+		payload = append([]byte{0x2f, 0x2f}, payload...)
+		for len(payload)%aes.BlockSize != 0 {
+			payload = append(payload, 0x2f)
+		}
+		k, err := hex.DecodeString(key)
+		assert.NoError(t, err)
+		block, err := aes.NewCipher(k)
+		assert.NoError(t, err)
+		iv := append(append([]byte{}, address...), bytes.Repeat([]byte{access}, 8)...)
+		encrypted := make([]byte, len(payload))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, payload)
+		payload = encrypted
+		cw = []byte{byte(len(payload) / aes.BlockSize << 4), modeAES}
+	}
+
+	data := []byte{0x00, 0x44}
+	data = append(data, address...)
+	data = append(data, ciShortHeader, access, 0x00)
+	data = append(data, cw...)
+	data = append(data, payload...)
+	data[0] = byte(len(data) - 1)
+	return data
+}
+
+func TestParseTelegram(t *testing.T) {
+	tel, err := ParseTelegram(telegram(t, testKey, records))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678", tel.ID)
+	assert.Equal(t, byte(0x2a), tel.Access)
+	assert.Equal(t, modeAES, tel.Mode())
+	assert.True(t, tel.Encrypted())
+	assert.Len(t, tel.Payload, 32)
+
+	_, err = ParseTelegram([]byte{0x20, 0x44})
+	assert.EqualError(t, err, "telegram too short: 2 bytes")
+
+	data := telegram(t, "", records)
+	data[10] = 0x8a
+	_, err = ParseTelegram(data)
+	assert.EqualError(t, err, "unsupported CI field 8a")
+}
+
+func TestFeedEncrypted(t *testing.T) {
+	r := New("", 0)
+	assert.NoError(t, r.SetKey("12345678", ""))
+	err := r.Feed(telegram(t, testKey, records))
+	assert.EqualError(t, err, "no key for wmbus meter 12345678")
+
+	assert.NoError(t, r.SetKey("12345678", "0f0e0d0c0b0a09080706050403020100"))
+	err = r.Feed(telegram(t, testKey, records))
+	assert.EqualError(t, err, "error decrypting telegram from 12345678: wrong key")
+
+	_, err = r.ReadValues("kamstrup-multical-403", "12345678")
+	assert.EqualError(t, err, "no telegram received from wmbus meter 12345678")
+
+	assert.NoError(t, r.SetKey("12345678", testKey))
+	assert.NoError(t, r.Feed(telegram(t, testKey, records)))
+
+	data, err := r.ReadValues("kamstrup-multical-403", "12345678")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678", data.Id)
+	assert.Equal(t, "kamstrup-multical-403", data.Model)
+	assert.InDelta(t, 12345000, data.Total_WH, 0.001)
+	assert.InDelta(t, 1234.56, data.Volume_M3, 0.001)
+	assert.InDelta(t, 45.12, data.Supply_C, 0.001)
+	assert.InDelta(t, 38.90, data.Return_C, 0.001)
+}
+
+func TestRead(t *testing.T) {
+	r := New("", 0)
+	assert.NoError(t, r.SetKey("12345678", ""))
+	stream := append(telegram(t, "", records), telegram(t, "", records[:6])...)
+	err := r.read(bytes.NewReader(stream))
+	assert.ErrorIs(t, err, io.EOF)
+
+	data, err := r.ReadValues("", "12345678")
+	assert.NoError(t, err)
+	assert.InDelta(t, 12345000, data.Total_WH, 0.001)
+	assert.Equal(t, 0.0, data.Volume_M3) // last telegram only had energy
+}
+
+func TestSetKey(t *testing.T) {
+	r := New("", 0)
+	assert.Error(t, r.SetKey("12345678", "zz"))
+	assert.EqualError(t, r.SetKey("12345678", "0011"), "key for wmbus meter 12345678 must be 16 bytes got 2")
+	assert.NoError(t, r.SetKey("12345678", testKey))
+	assert.Len(t, r.keys, 1)
+	assert.NoError(t, r.SetKey("12345678", ""))
+	assert.Equal(t, map[string][]byte{"12345678": nil}, r.keys)
+}
+
+func TestFeedUnknownMeter(t *testing.T) {
+	r := New("", 0)
+	assert.NoError(t, r.SetKey("87654321", ""))
+	err := r.Feed(telegram(t, "", records))
+	assert.EqualError(t, err, "wmbus meter 12345678 is not configured")
+	assert.Empty(t, r.meters)
+}
+
+// omsExample is the mode 5 example telegram from OMS specification volume 2 annex N.
+// It is from an Elster gas meter with id 12345678 and volume 28504.27 m3.
+const (
+	omsExample    = "2e4493157856341233037a2a0020055923c95aaa26d1b2e7493b013ec4a6f6d3529b520edff0ea6defc99d6d69ebf3"
+	omsExampleKey = "0102030405060708090a0b0c0d0e0f11"
+)
+
+func TestFeedOMSExample(t *testing.T) {
+	data, err := hex.DecodeString(omsExample)
+	assert.NoError(t, err)
+
+	r := New("", 0)
+	assert.NoError(t, r.SetKey("12345678", omsExampleKey))
+	assert.NoError(t, r.Feed(data))
+
+	values, err := r.ReadValues("", "12345678")
+	assert.NoError(t, err)
+	assert.InDelta(t, 28504.27, values.Volume_M3, 0.001)
+}
+
+func TestRetain(t *testing.T) {
+	r := New("", 0)
+	assert.NoError(t, r.SetKey("12345678", testKey))
+	assert.NoError(t, r.SetKey("87654321", testKey))
+	assert.NoError(t, r.Feed(telegram(t, testKey, records)))
+
+	r.Retain([]string{"87654321"})
+	assert.Len(t, r.keys, 1)
+	_, err := r.ReadValues("", "12345678")
+	assert.EqualError(t, err, "no telegram received from wmbus meter 12345678")
+}
@@ -0,0 +1,134 @@
+package wmbus
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/jonaz/gombus"
+)
+
+const (
+	ciLongHeader  = 0x72
+	ciShortHeader = 0x7A
+
+	modeNone = 0
+	modeAES  = 5 // AES-128-CBC with IV from address and access number
+)
+
+// Telegram is a wM-Bus telegram received in T1/C1 mode with the CRCs removed by the receiver.
+type Telegram struct {
+	ID     string // 8 digit meter id
+	Access byte
+	Status byte
+
+	// address is manufacturer, id, version and medium in the same order as in the frame.
+	address    []byte
+	configWord uint16
+	Payload    []byte
+}
+
+// ParseTelegram parses a telegram starting with the L-field.
+func ParseTelegram(data []byte) (*Telegram, error) {
+	if len(data) < 15 {
+		return nil, fmt.Errorf("telegram too short: %d bytes", len(data))
+	}
+	l := int(data[0])
+	if len(data) < l+1 {
+		return nil, fmt.Errorf("telegram length %d but got %d bytes", l, len(data)-1)
+	}
+	data = data[:l+1]
+
+	t := &Telegram{}
+	switch ci := data[10]; ci {
+	case ciShortHeader:
+		t.address = append([]byte{}, data[2:10]...)
+		t.Access = data[11]
+		t.Status = data[12]
+		t.configWord = uint16(data[13]) | uint16(data[14])<<8
+		t.Payload = data[15:]
+	case ciLongHeader:
+		if len(data) < 23 {
+			return nil, fmt.Errorf("telegram too short for long header: %d bytes", len(data))
+		}
+		t.address = append(append([]byte{}, data[15:17]...), data[11:15]...)
+		t.address = append(t.address, data[17:19]...)
+		t.Access = data[19]
+		t.Status = data[20]
+		t.configWord = uint16(data[21]) | uint16(data[22])<<8
+		t.Payload = data[23:]
+	default:
+		return nil, fmt.Errorf("unsupported CI field %02x", ci)
+	}
+	t.ID = fmt.Sprintf("%02x%02x%02x%02x", t.address[5], t.address[4], t.address[3], t.address[2])
+	return t, nil
+}
+
+// Mode is the security mode from the configuration word.
+func (t *Telegram) Mode() int {
+	return int(t.configWord>>8) & 0x1F
+}
+
+// Encrypted returns true if the payload still needs to be decrypted.
+func (t *Telegram) Encrypted() bool {
+	return t.Mode() != modeNone
+}
+
+// Decrypt decrypts the payload with the meter's 16 byte AES key.
+func (t *Telegram) Decrypt(key []byte) error {
+	switch t.Mode() {
+	case modeNone:
+		return nil
+	case modeAES:
+	default:
+		return fmt.Errorf("unsupported security mode %d", t.Mode())
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	n := int(t.configWord>>4&0x0F) * aes.BlockSize
+	if n == 0 || n > len(t.Payload) {
+		n = len(t.Payload) / aes.BlockSize * aes.BlockSize
+	}
+
+	decrypted := make([]byte, n)
+	cipher.NewCBCDecrypter(block, t.iv()).CryptBlocks(decrypted, t.Payload[:n])
+	if !bytes.HasPrefix(decrypted, []byte{0x2F, 0x2F}) {
+		return fmt.Errorf("error decrypting telegram from %s: wrong key", t.ID)
+	}
+
+	t.Payload = append(decrypted, t.Payload[n:]...)
+	t.configWord &^= 0x1F00
+	return nil
+}
+
+// iv is manufacturer and address followed by the access number 8 times.
+func (t *Telegram) iv() []byte {
+	return append(append([]byte{}, t.address...), bytes.Repeat([]byte{t.Access}, 8)...)
+}
+
+// LongFrame converts a decrypted telegram to a wired M-Bus variable data response so it can be decoded by gombus.
+func (t *Telegram) LongFrame() (gombus.LongFrame, error) {
+	if t.Encrypted() {
+		return nil, fmt.Errorf("telegram from %s is encrypted", t.ID)
+	}
+	body := []byte{0x08, 0xFE, ciLongHeader}
+	body = append(body, t.address[2:6]...) // id
+	body = append(body, t.address[0:2]...) // manufacturer
+	body = append(body, t.address[6:8]...) // version and medium
+	body = append(body, t.Access, t.Status, 0x00, 0x00)
+	body = append(body, t.Payload...)
+	if len(body) > 255 {
+		return nil, fmt.Errorf("telegram from %s too long: %d bytes", t.ID, len(body))
+	}
+
+	frame := gombus.LongFrame{0x68, 0x00, 0x00, 0x68}
+	frame = append(frame, body...)
+	frame = append(frame, 0x00, 0x16)
+	frame.SetLength()
+	frame.SetChecksum()
+	return frame, nil
+}